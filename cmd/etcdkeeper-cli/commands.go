@@ -0,0 +1,524 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/apiv1/types"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/client"
+	"golang.org/x/term"
+)
+
+// importBatchSize is the number of puts sent per batch request by import.
+const importBatchSize = 500
+
+// dump is the file written by export and read by import and diff.
+type dump struct {
+	Prefix   string  `json:"prefix"`
+	Revision int64   `json:"revision"`
+	Kvs      []entry `json:"kvs"`
+}
+
+// entry is a key of a dump. Binary values are saved in base64.
+type entry struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+func (e entry) bytes() ([]byte, error) {
+	value, err := types.DecodeValue(e.Value, e.Encoding)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %v", e.Key, err)
+	}
+	return value, nil
+}
+
+func runLogin(ctx context.Context, opts *options, fs *flag.FlagSet, args []string) error {
+	user := fs.String("user", "", "etcd user, the password is read from ETCDKEEPER_PASSWORD or prompted for")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	// There is no password flag, command lines are visible to other users
+	// in ps.
+	password := os.Getenv("ETCDKEEPER_PASSWORD")
+	if *user != "" && password == "" {
+		var err error
+		if password, err = readPassword(); err != nil {
+			return err
+		}
+	}
+
+	server := opts.server
+	if server == "" {
+		server = defaultServer
+	}
+	c := client.New(server)
+	resp, err := c.Connect(ctx, types.ConnectRequest{Host: fs.Arg(0), Username: *user, Password: password})
+	if err != nil {
+		return err
+	}
+	if err = saveSession(session{Server: server, Token: resp.Token}); err != nil {
+		return err
+	}
+	fmt.Printf("Logged in to %s through %s, etcd %s\n", fs.Arg(0), server, resp.Info["version"])
+	return nil
+}
+
+// readPassword prompts for a password without echoing it. Input that is not
+// a terminal is read up to the first newline.
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return string(password), err
+}
+
+func runLogout(ctx context.Context, opts *options, fs *flag.FlagSet, args []string) error {
+	fs.Parse(args)
+	path, err := sessionPath()
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func runGet(ctx context.Context, opts *options, fs *flag.FlagSet, args []string) error {
+	asJSON := fs.Bool("json", false, "print the key-value with its metadata as JSON")
+	encoding := fs.String("encoding", "", "encoding of the value in the JSON output: auto, text, base64 or hex")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	c, err := connect(opts)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		kv, err := c.GetKey(ctx, fs.Arg(0), *encoding)
+		if err != nil {
+			return err
+		}
+		return printJSON(kv)
+	}
+	kv, err := c.GetKey(ctx, fs.Arg(0), types.EncodingBase64)
+	if err != nil {
+		return err
+	}
+	value, err := types.DecodeValue(kv.Value, kv.Encoding)
+	if err != nil {
+		return err
+	}
+	os.Stdout.Write(value)
+	if len(value) > 0 && value[len(value)-1] != '\n' && !types.IsBinary(value) {
+		fmt.Println()
+	}
+	return nil
+}
+
+func runPut(ctx context.Context, opts *options, fs *flag.FlagSet, args []string) error {
+	ttl := fs.Int64("ttl", 0, "attach the key to a new lease with this TTL in seconds")
+	lease := fs.String("lease", "", "attach the key to this lease, in hexadecimal")
+	validateFormat := fs.Bool("validate-format", false, "reject values that do not parse in the format of the key")
+	protoJSON := fs.Bool("proto-json", false, "the value is the JSON rendering of the protobuf message mapped to the key")
+	fs.Parse(args)
+	if fs.NArg() != 1 && fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var value []byte
+	if fs.NArg() == 2 && fs.Arg(1) != "-" {
+		value = []byte(fs.Arg(1))
+	} else {
+		var err error
+		if value, err = ioutil.ReadAll(os.Stdin); err != nil {
+			return err
+		}
+	}
+	c, err := connect(opts)
+	if err != nil {
+		return err
+	}
+
+	req := types.PutKeyRequest{
+		Key:            fs.Arg(0),
+		Value:          base64.StdEncoding.EncodeToString(value),
+		Encoding:       types.EncodingBase64,
+		TTL:            *ttl,
+		Lease:          *lease,
+		ValidateFormat: *validateFormat,
+	}
+	if *protoJSON {
+		req.Value, req.Encoding, req.ProtoJSON = string(value), types.EncodingText, true
+	}
+	kv, err := c.PutKey(ctx, req)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("OK, revision %d\n", kv.ModRevision)
+	return nil
+}
+
+func runDelete(ctx context.Context, opts *options, fs *flag.FlagSet, args []string) error {
+	prefix := fs.Bool("prefix", false, "delete every key starting with the key")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	c, err := connect(opts)
+	if err != nil {
+		return err
+	}
+	resp, err := c.DeleteKey(ctx, fs.Arg(0), *prefix)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Deleted %d key(s), revision %d\n", resp.Deleted, resp.Revision)
+	return nil
+}
+
+func runList(ctx context.Context, opts *options, fs *flag.FlagSet, args []string) error {
+	flat := fs.Bool("flat", false, "print one key per line")
+	separator := fs.String("sep", "/", "separator of the key tree")
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	c, err := connect(opts)
+	if err != nil {
+		return err
+	}
+	var keys []string
+	_, err = listKeys(ctx, c, fs.Arg(0), true, func(kv types.KeyValue) error {
+		keys = append(keys, kv.Key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if *flat {
+		for _, key := range keys {
+			fmt.Println(key)
+		}
+		return nil
+	}
+	printTree(os.Stdout, fs.Arg(0), keys, *separator)
+	return nil
+}
+
+// printTree prints keys, sorted and starting with prefix, as an indented
+// tree of their segments below prefix.
+func printTree(w io.Writer, prefix string, keys []string, separator string) {
+	depth := 0
+	if prefix != "" {
+		fmt.Fprintln(w, prefix)
+		depth = 1
+	}
+	var prev []string
+	for _, key := range keys {
+		parts := strings.Split(strings.TrimPrefix(key, prefix), separator)
+		// Only the directories of the previous key are shared, its last
+		// segment is a key of its own.
+		common := 0
+		for common < len(prev)-1 && common < len(parts)-1 && prev[common] == parts[common] {
+			common++
+		}
+		for i := common; i < len(parts); i++ {
+			name := parts[i]
+			if i < len(parts)-1 {
+				name += separator
+			}
+			fmt.Fprintf(w, "%s%s\n", strings.Repeat("  ", depth+i), name)
+		}
+		prev = parts
+	}
+}
+
+func runExport(ctx context.Context, opts *options, fs *flag.FlagSet, args []string) error {
+	output := fs.String("o", "", "write to this file instead of stdout")
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	c, err := connect(opts)
+	if err != nil {
+		return err
+	}
+	d := dump{Prefix: fs.Arg(0), Kvs: []entry{}}
+	d.Revision, err = listKeys(ctx, c, d.Prefix, false, func(kv types.KeyValue) error {
+		e := entry{Key: kv.Key, Value: kv.Value}
+		if kv.Encoding != types.EncodingText {
+			e.Encoding = kv.Encoding
+		}
+		d.Kvs = append(d.Kvs, e)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if *output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err = ioutil.WriteFile(*output, data, 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d key(s) at revision %d\n", len(d.Kvs), d.Revision)
+	return nil
+}
+
+// runImport writes every key of a dump, in batches. Keys that fail, e.g. on
+// a schema or a permission, are reported and the others are still written.
+func runImport(ctx context.Context, opts *options, fs *flag.FlagSet, args []string) error {
+	validateFormat := fs.Bool("validate-format", false, "reject values that do not parse in the format of their key")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	d, err := readDump(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	c, err := connect(opts)
+	if err != nil {
+		return err
+	}
+
+	ops := make([]types.TxnOp, 0, len(d.Kvs))
+	for _, e := range d.Kvs {
+		value, err := e.bytes()
+		if err != nil {
+			return err
+		}
+		ops = append(ops, types.TxnOp{Type: "put", Key: e.Key, Value: base64.StdEncoding.EncodeToString(value)})
+	}
+	var written, failed int
+	for len(ops) > 0 {
+		n := importBatchSize
+		if n > len(ops) {
+			n = len(ops)
+		}
+		resp, err := c.Batch(ctx, types.BatchRequest{Ops: ops[:n], Encoding: types.EncodingBase64, ValidateFormat: *validateFormat})
+		if err != nil {
+			return err
+		}
+		for _, r := range resp.Results {
+			if !r.OK {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", r.Key, r.Error)
+			}
+		}
+		written += resp.Succeeded
+		failed += resp.Failed
+		ops = ops[n:]
+	}
+	fmt.Printf("Imported %d key(s)\n", written)
+	if failed > 0 {
+		return fmt.Errorf("%d key(s) failed", failed)
+	}
+	return nil
+}
+
+// runDiff compares a dump with the keys on the server: + keys are only in
+// the file, - keys only on the server and ~ keys have another value.
+func runDiff(ctx context.Context, opts *options, fs *flag.FlagSet, args []string) error {
+	values := fs.Bool("values", false, "print the values of the keys that differ")
+	fs.Parse(args)
+	if fs.NArg() != 1 && fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	d, err := readDump(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	prefix := d.Prefix
+	if fs.NArg() == 2 {
+		prefix = fs.Arg(1)
+	}
+	c, err := connect(opts)
+	if err != nil {
+		return err
+	}
+
+	local := make(map[string][]byte, len(d.Kvs))
+	for _, e := range d.Kvs {
+		if !strings.HasPrefix(e.Key, prefix) {
+			continue
+		}
+		if local[e.Key], err = e.bytes(); err != nil {
+			return err
+		}
+	}
+	remote := make(map[string][]byte)
+	_, err = listKeys(ctx, c, prefix, false, func(kv types.KeyValue) error {
+		value, err := types.DecodeValue(kv.Value, kv.Encoding)
+		remote[kv.Key] = value
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(local)+len(remote))
+	for key := range local {
+		keys = append(keys, key)
+	}
+	for key := range remote {
+		if _, ok := local[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	differs := false
+	for _, key := range keys {
+		l, inFile := local[key]
+		r, onServer := remote[key]
+		switch {
+		case !onServer:
+			fmt.Printf("+ %s\n", key)
+		case !inFile:
+			fmt.Printf("- %s\n", key)
+		case !bytes.Equal(l, r):
+			fmt.Printf("~ %s\n", key)
+		default:
+			continue
+		}
+		differs = true
+		if *values {
+			if inFile {
+				fmt.Printf("    file:   %s\n", displayValue(l))
+			}
+			if onServer {
+				fmt.Printf("    server: %s\n", displayValue(r))
+			}
+		}
+	}
+	if differs {
+		return errDiffers
+	}
+	return nil
+}
+
+func runWatch(ctx context.Context, opts *options, fs *flag.FlagSet, args []string) error {
+	prefix := fs.Bool("prefix", false, "watch every key starting with the key")
+	revision := fs.Int64("rev", 0, "start from this revision instead of now")
+	prevKV := fs.Bool("prev", false, "print the previous value too")
+	asJSON := fs.Bool("json", false, "print every event as a JSON line")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	c, err := connect(opts)
+	if err != nil {
+		return err
+	}
+	req := types.WatchRequest{Key: fs.Arg(0), Prefix: *prefix, Revision: *revision, PrevKV: *prevKV}
+	return c.Watch(ctx, req, func(ev types.WatchEvent) error {
+		if *asJSON {
+			data, err := json.Marshal(ev)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+		line := fmt.Sprintf("%d %s %s", ev.Revision, strings.ToUpper(ev.Type), ev.Kv.Key)
+		if ev.Type == "put" {
+			line += " " + ev.Kv.Value
+		}
+		if ev.PrevKv != nil {
+			line += " (was " + ev.PrevKv.Value + ")"
+		}
+		fmt.Println(line)
+		return nil
+	})
+}
+
+// listKeys calls fn with every key starting with prefix, a page at a time,
+// and returns the revision they were read at. Every page is read at the
+// revision of the first one, so writes made meanwhile are not mixed in.
+func listKeys(ctx context.Context, c *client.Client, prefix string, keysOnly bool, fn func(types.KeyValue) error) (int64, error) {
+	req := types.ListKeysRequest{Prefix: prefix, KeysOnly: keysOnly}
+	for {
+		resp, err := c.ListKeys(ctx, req)
+		if err != nil {
+			return 0, err
+		}
+		req.Revision = resp.Revision
+		for _, kv := range resp.Kvs {
+			if err = fn(kv); err != nil {
+				return 0, err
+			}
+		}
+		if !resp.More || len(resp.Kvs) == 0 {
+			return req.Revision, nil
+		}
+		req.After = resp.Kvs[len(resp.Kvs)-1].Key
+	}
+}
+
+func readDump(path string) (*dump, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var d dump
+	if err = json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for _, e := range d.Kvs {
+		if e.Key == "" {
+			return nil, errors.New(path + ": key is required")
+		}
+	}
+	return &d, nil
+}
+
+// displayValue shows a value on one line, binary values in base64.
+func displayValue(value []byte) string {
+	if types.IsBinary(value) {
+		return "base64:" + base64.StdEncoding.EncodeToString(value)
+	}
+	return fmt.Sprintf("%q", value)
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
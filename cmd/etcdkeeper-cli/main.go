@@ -0,0 +1,188 @@
+// Command etcdkeeper-cli reads and writes etcd through an etcdkeeper server,
+// for machines that can reach etcdkeeper but not etcd itself. Every request
+// goes through the /api/v1 endpoints, so the etcd permissions, API token
+// scopes, schema checks and audit log of the server apply.
+//
+//	etcdkeeper-cli -server http://etcdkeeper:8080 login -user root 127.0.0.1:2379
+//	etcdkeeper-cli ls /app/
+//	etcdkeeper-cli export /app/ > app.json
+//	etcdkeeper-cli diff app.json
+//	etcdkeeper-cli import app.json
+//
+// login saves the server and the token in the user configuration directory,
+// an API token can be given with -token or ETCDKEEPER_TOKEN instead. The etcd
+// password is prompted for, or read from ETCDKEEPER_PASSWORD.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/client"
+)
+
+const defaultServer = "http://127.0.0.1:8080"
+
+// errDiffers makes the command exit with status 1 without a message, as
+// diff does when its inputs differ.
+var errDiffers = errors.New("differences found")
+
+// session is what login saves for the next commands.
+type session struct {
+	Server string `json:"server"`
+	Token  string `json:"token"`
+}
+
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(ctx context.Context, opts *options, fs *flag.FlagSet, args []string) error
+}
+
+// options are the global flags.
+type options struct {
+	server string
+	token  string
+}
+
+var commands = []command{
+	{"login", "login [-user name] <etcd host>", "log in to an etcd cluster and save the session", runLogin},
+	{"logout", "logout", "forget the saved session", runLogout},
+	{"get", "get [-json] [-encoding enc] <key>", "print the value of a key", runGet},
+	{"put", "put [-ttl seconds] [-lease id] [-validate-format] [-proto-json] <key> [value]", "write a key, the value is read from stdin when omitted", runPut},
+	{"delete", "delete [-prefix] <key>", "delete a key, or every key starting with it", runDelete},
+	{"ls", "ls [-flat] [-sep separator] [prefix]", "list the keys starting with prefix as a tree", runList},
+	{"export", "export [-o file] [prefix]", "write the keys starting with prefix as JSON", runExport},
+	{"import", "import [-validate-format] <file>", "write the keys of an export", runImport},
+	{"diff", "diff [-values] <file> [prefix]", "compare an export with the keys on the server", runDiff},
+	{"watch", "watch [-prefix] [-rev revision] [-prev] [-json] <key>", "print the changes to a key until interrupted", runWatch},
+}
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.server, "server", os.Getenv("ETCDKEEPER_SERVER"), "etcdkeeper URL, the one of the saved session by default")
+	flag.StringVar(&opts.token, "token", os.Getenv("ETCDKEEPER_TOKEN"), "API token, the one of the saved session by default")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := flag.Arg(0)
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		err := cmd.run(ctx, &opts, newFlagSet(cmd), flag.Args()[1:])
+		stop()
+		if errors.Is(err, errDiffers) {
+			os.Exit(1)
+		}
+		if err != nil && !errors.Is(err, context.Canceled) {
+			fmt.Fprintf(os.Stderr, "etcdkeeper-cli %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "etcdkeeper-cli: unknown command %s\n", name)
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: etcdkeeper-cli [-server url] [-token token] <command> [arguments]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-8s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(out, "\nRun etcdkeeper-cli <command> -h for the arguments of a command.\n\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// newFlagSet returns the flag set of a command, printing its usage line on
+// -h and parse errors.
+func newFlagSet(cmd command) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: etcdkeeper-cli %s\n\n%s.\n", cmd.usage, cmd.summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// connect returns a client for the server of the flags or of the saved
+// session, authenticated with the token of either.
+func connect(opts *options) (*client.Client, error) {
+	s, err := loadSession()
+	if err != nil {
+		return nil, err
+	}
+	server, token := opts.server, opts.token
+	if server == "" {
+		server = s.Server
+	}
+	if server == "" {
+		server = defaultServer
+	}
+	if token == "" && strings.TrimSuffix(server, "/") == strings.TrimSuffix(s.Server, "/") {
+		token = s.Token
+	}
+	if token == "" {
+		return nil, errors.New("not logged in, run etcdkeeper-cli login or set ETCDKEEPER_TOKEN")
+	}
+	return client.New(server, client.WithToken(token)), nil
+}
+
+func sessionPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "etcdkeeper", "cli.json"), nil
+}
+
+// loadSession returns the saved session, empty when there is none.
+func loadSession() (session, error) {
+	var s session
+	path, err := sessionPath()
+	if err != nil {
+		return s, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	if err = json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("%s: %v", path, err)
+	}
+	return s, nil
+}
+
+func saveSession(s session) error {
+	path, err := sessionPath()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
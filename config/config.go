@@ -1,33 +1,80 @@
 package config
 
 import (
-	_ "github.com/joho/godotenv/autoload"
-	"github.com/trinhdaiphuc/env_config"
+	"sync/atomic"
 	"time"
+
+	_ "github.com/joho/godotenv/autoload"
 )
 
+// DefaultSecretKey is the default of SecretKey. Anyone knowing it can forge
+// JWTs and decrypt the token passwords, API tokens are refused while it is
+// used.
+const DefaultSecretKey = "secret"
+
+// AppConfig holds the settings of the server. Every field is read from the
+// environment variable of its env tag, falling back to the default after the
+// comma, and can be overridden by the flag of the same name in lower case
+// with dashes (PORT is -port, USE_TLS is -use-tls), see Load. Settings
+// tagged reload:"restart" are only read at startup, Reload keeps them, and
+// those tagged secret:"true" are hidden by check-config.
 type AppConfig struct {
-	Host           string        `env:"HOST,0.0.0.0"`
-	Port           int           `env:"PORT,8080"`
-	Separator      string        `env:"SEPARATOR,/"`
-	UseTLS         bool          `env:"USE_TLS,false"`
-	KeyFile        string        `env:"KEY_FILE"`
-	CertFile       string        `env:"CERT_FILE"`
-	CaFile         string        `env:"CA_FILE"`
-	UseAuth        bool          `env:"USE_AUTH,true"`
-	ConnectTimeout time.Duration `env:"CONNECT_TIMEOUT,5s"`
-	SecretKey      []byte        `env:"SECRET_KEY,secret"`
-	ExpiredTime    time.Duration `env:"EXPIRED_TIME,24h"`
+	Host           string        `env:"HOST,0.0.0.0" usage:"address the HTTP server listens on" reload:"restart"`
+	Port           int           `env:"PORT,8080" usage:"port the HTTP server listens on" reload:"restart"`
+	Separator      string        `env:"SEPARATOR,/" usage:"separator of the key tree" reload:"restart"`
+	UseTLS         bool          `env:"USE_TLS,false" usage:"connect to etcd v3 with TLS"`
+	KeyFile        string        `env:"KEY_FILE" usage:"TLS key identifying the etcd client"`
+	CertFile       string        `env:"CERT_FILE" usage:"TLS certificate identifying the etcd client"`
+	CaFile         string        `env:"CA_FILE" usage:"CA bundle verifying the etcd servers"`
+	UseAuth        bool          `env:"USE_AUTH,true" usage:"use etcd authentication"`
+	ConnectTimeout time.Duration `env:"CONNECT_TIMEOUT,5s" usage:"etcd connect and request timeout"`
+	SecretKey      []byte        `env:"SECRET_KEY,secret" usage:"key signing the JWTs and encrypting the API token passwords, prefer the environment" reload:"restart" secret:"true"`
+	ExpiredTime    time.Duration `env:"EXPIRED_TIME,24h" usage:"lifetime of the JWTs"`
+
+	PoolIdleTTL        time.Duration `env:"POOL_IDLE_TTL,10m" usage:"close etcd clients unused for this long" reload:"restart"`
+	PoolHealthInterval time.Duration `env:"POOL_HEALTH_INTERVAL,30s" usage:"how often pooled etcd clients are health-checked" reload:"restart"`
+
+	AdminUsers            string `env:"ADMIN_USERS,root" usage:"comma separated etcd users allowed to use the admin endpoints"`
+	AllowAdminWithoutAuth bool   `env:"ALLOW_ADMIN_WITHOUT_AUTH,false" usage:"allow the admin endpoints when use-auth is false"`
+	AuditLogFile          string `env:"AUDIT_LOG_FILE" usage:"append admin operations as JSON lines to this file instead of stdout" reload:"restart"`
+
+	ProtoDir string `env:"PROTO_DIR,proto" usage:"directory of the protobuf descriptor sets and key mappings" reload:"restart"`
+
+	SchemaFile     string `env:"SCHEMA_FILE" usage:"JSON list of schemas validating the values of matching keys" reload:"restart"`
+	SchemaPrefix   string `env:"SCHEMA_PREFIX" usage:"read more schemas from the documents under this prefix"`
+	SchemaUser     string `env:"SCHEMA_USER" usage:"etcd user reading the schemas under schema-prefix for every request, read access to it is enough"`
+	SchemaPassword string `env:"SCHEMA_PASSWORD" usage:"password of schema-user, prefer the environment" secret:"true"`
+
+	KeyFormats string `env:"KEY_FORMATS" usage:"comma separated glob=format tags of the keys"`
+
+	MaxTxnOps int `env:"MAX_TXN_OPS,128" usage:"operations per transaction of the batch endpoint"`
+
+	TokenFile string `env:"TOKEN_FILE,tokens.json" usage:"file of the hashed API tokens" reload:"restart"`
+
+	ReadyClusters string `env:"READY_CLUSTERS" usage:"comma separated etcd v3 endpoints that must answer for /readyz to report ready"`
+
+	MetricsClusters string `env:"METRICS_CLUSTERS" usage:"comma separated etcd endpoints the etcd metrics are labelled with, besides READY_CLUSTERS, the others share the label other"`
+	MetricsToken    string `env:"METRICS_TOKEN" usage:"bearer token /metrics requires, open when empty" secret:"true"`
+
+	ServerCertFile      string `env:"SERVER_CERT_FILE" usage:"serve HTTPS with this certificate instead of HTTP"`
+	ServerKeyFile       string `env:"SERVER_KEY_FILE" usage:"key of the HTTPS certificate"`
+	ServerClientCaFile  string `env:"SERVER_CLIENT_CA_FILE" usage:"require client certificates signed by this CA bundle (mTLS), except on /healthz and /readyz"`
+	ServerTLSMinVersion string `env:"SERVER_TLS_MIN_VERSION,1.2" usage:"minimum TLS version of the HTTPS server: 1.2 or 1.3"`
+
+	LogLevel       string        `env:"LOG_LEVEL,info" usage:"log level: debug, info, warn, error or off"`
+	LogFormat      string        `env:"LOG_FORMAT,json" usage:"log format: json, or text for one line per entry with the fields in JSON" reload:"restart"`
+	ReloadInterval time.Duration `env:"RELOAD_INTERVAL,5s" usage:"how often the config and TLS files are checked for changes, 0 disables it" reload:"restart"`
 }
 
-var cfg = &AppConfig{}
+var current atomic.Value
 
-func Load() {
-	if err := env_config.EnvStruct(cfg); err != nil {
-		panic(err)
-	}
+func init() {
+	current.Store(&AppConfig{})
 }
 
+// GetConfig returns the current configuration. It is replaced as a whole by
+// Load and Reload and must not be modified, callers that read several
+// settings together should keep the returned pointer.
 func GetConfig() *AppConfig {
-	return cfg
+	return current.Load().(*AppConfig)
 }
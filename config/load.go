@@ -0,0 +1,328 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Sources of a setting, from the lowest precedence to the highest.
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// ConfigFileEnv names the configuration file when -config is not given.
+const ConfigFileEnv = "CONFIG_FILE"
+
+// Setting is the value of a configuration setting and where it comes from.
+type Setting struct {
+	Name   string
+	Env    string
+	Value  string
+	Source string
+	secret bool
+}
+
+// String shows the setting for check-config, hiding secrets.
+func (s Setting) String() string {
+	value := strconv.Quote(s.Value)
+	if s.secret && s.Source != SourceDefault {
+		value = "(hidden)"
+	}
+	return fmt.Sprintf("%s = %s (%s)", s.Name, value, s.Source)
+}
+
+// Error lists every problem of a configuration.
+type Error struct {
+	Problems []string
+}
+
+func (e *Error) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+// field is a setting of AppConfig.
+type field struct {
+	name  string
+	env   string
+	def   string
+	usage string
+	index int
+	typ   reflect.Type
+	// restart is set for the settings Reload cannot change.
+	restart bool
+	// secret is set for the settings check-config hides.
+	secret bool
+}
+
+func fields() []field {
+	t := reflect.TypeOf(AppConfig{})
+	list := make([]field, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := strings.SplitN(f.Tag.Get("env"), ",", 2)
+		ff := field{
+			name:    strings.ReplaceAll(strings.ToLower(tag[0]), "_", "-"),
+			env:     tag[0],
+			usage:   f.Tag.Get("usage"),
+			index:   i,
+			typ:     f.Type,
+			restart: f.Tag.Get("reload") == "restart",
+			secret:  f.Tag.Get("secret") == "true",
+		}
+		if len(tag) == 2 {
+			ff.def = tag[1]
+		}
+		list = append(list, ff)
+	}
+	return list
+}
+
+// NewFlagSet returns a flag set with a flag for every setting of AppConfig,
+// and -config, for Load to parse.
+func NewFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	for _, f := range fields() {
+		usage := fmt.Sprintf("%s (env %s)", f.usage, f.env)
+		switch f.typ {
+		case reflect.TypeOf(false):
+			def, _ := strconv.ParseBool(f.def)
+			fs.Bool(f.name, def, usage)
+		case reflect.TypeOf(0):
+			def, _ := strconv.Atoi(f.def)
+			fs.Int(f.name, def, usage)
+		case reflect.TypeOf(time.Duration(0)):
+			def, _ := time.ParseDuration(f.def)
+			fs.Duration(f.name, def, usage)
+		default:
+			fs.String(f.name, f.def, usage)
+		}
+	}
+	fs.String("config", os.Getenv(ConfigFileEnv), "YAML, TOML or JSON file of settings named like the flags (env "+ConfigFileEnv+")")
+	return fs
+}
+
+// Load parses args with fs, a flag set of NewFlagSet, and makes the result
+// the configuration returned by GetConfig. Each setting comes from, by
+// precedence, its flag, its environment variable, the -config file or its
+// default. Empty environment variables are ignored. Problems are reported
+// together in an *Error, the configuration is left unchanged then.
+func Load(fs *flag.FlagSet, args []string) ([]Setting, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	c, settings, err := build(fs)
+	if err != nil {
+		return nil, err
+	}
+	current.Store(c)
+	return settings, nil
+}
+
+// build reads the settings of a parsed flag set.
+func build(fs *flag.FlagSet) (*AppConfig, []Setting, error) {
+	var problems []string
+	fileValues := map[string]string{}
+	path := fs.Lookup("config").Value.String()
+	if path != "" {
+		var err error
+		if fileValues, err = readFile(path); err != nil {
+			return nil, nil, &Error{Problems: []string{err.Error()}}
+		}
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	c := &AppConfig{}
+	v := reflect.ValueOf(c).Elem()
+	settings := make([]Setting, 0, v.NumField())
+	known := map[string]bool{}
+	for _, f := range fields() {
+		known[f.name] = true
+		s := Setting{Name: f.name, Env: f.env, Value: f.def, Source: SourceDefault, secret: f.secret}
+		where := "default"
+		if value, ok := fileValues[f.name]; ok {
+			s.Value, s.Source, where = value, SourceFile, path+": "+f.name
+		}
+		if value := os.Getenv(f.env); value != "" {
+			s.Value, s.Source, where = value, SourceEnv, f.env
+		}
+		if set[f.name] {
+			s.Value, s.Source, where = fs.Lookup(f.name).Value.String(), SourceFlag, "-"+f.name
+		}
+		if err := setField(v.Field(f.index), s.Value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", where, err))
+		}
+		settings = append(settings, s)
+	}
+	var unknown []string
+	for name := range fileValues {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		problems = append(problems, fmt.Sprintf("%s: unknown setting %s", path, name))
+	}
+
+	if len(problems) == 0 {
+		// Settings that did not parse would be reported twice.
+		problems = c.validate()
+	}
+	if len(problems) > 0 {
+		return nil, nil, &Error{Problems: problems}
+	}
+	return c, settings, nil
+}
+
+// readFile reads the settings of a file, in YAML unless its extension is
+// .toml or .json.
+func readFile(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	case ".json":
+		err = json.Unmarshal(data, &raw)
+	default:
+		err = yaml.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	values := make(map[string]string, len(raw))
+	for name, value := range raw {
+		switch value := value.(type) {
+		case nil:
+			values[name] = ""
+		case string, bool, int, int64, float64, json.Number:
+			values[name] = fmt.Sprint(value)
+		default:
+			return nil, fmt.Errorf("%s: %s must be a string, a number or a boolean", path, name)
+		}
+	}
+	return values, nil
+}
+
+func setField(v reflect.Value, s string) error {
+	switch v.Interface().(type) {
+	case string:
+		v.SetString(s)
+	case []byte:
+		v.SetBytes([]byte(s))
+	case bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", s)
+		}
+		v.SetBool(b)
+	case int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", s)
+		}
+		v.SetInt(int64(n))
+	case time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, expected e.g. 300ms, 5s or 2h45m", s)
+		}
+		v.SetInt(int64(d))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// validate returns the problems of settings that parsed but cannot work.
+func (c *AppConfig) validate() []string {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		add("port: %d is not a TCP port", c.Port)
+	}
+	if c.Separator == "" {
+		add("separator: must not be empty")
+	}
+	if len(c.SecretKey) == 0 {
+		add("secret-key: must not be empty")
+	}
+	for name, d := range map[string]time.Duration{
+		"connect-timeout":      c.ConnectTimeout,
+		"expired-time":         c.ExpiredTime,
+		"pool-idle-ttl":        c.PoolIdleTTL,
+		"pool-health-interval": c.PoolHealthInterval,
+	} {
+		if d <= 0 {
+			add("%s: must be positive, got %s", name, d)
+		}
+	}
+	if c.ReloadInterval < 0 {
+		add("reload-interval: must not be negative, got %s", c.ReloadInterval)
+	}
+	switch c.LogLevel {
+	case "debug", "info", "warn", "error", "off":
+	default:
+		add("log-level: unknown level %q, expected debug, info, warn, error or off", c.LogLevel)
+	}
+	if c.LogFormat != "json" && c.LogFormat != "text" {
+		add("log-format: unknown format %q, expected json or text", c.LogFormat)
+	}
+	if c.MaxTxnOps < 1 {
+		add("max-txn-ops: must be positive, got %d", c.MaxTxnOps)
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		add("cert-file, key-file: must be set together")
+	}
+	if (c.ServerCertFile == "") != (c.ServerKeyFile == "") {
+		add("server-cert-file, server-key-file: must be set together")
+	}
+	if c.ServerClientCaFile != "" && c.ServerCertFile == "" {
+		add("server-client-ca-file: needs server-cert-file, client certificates are only checked over HTTPS")
+	}
+	if c.SchemaPrefix != "" && c.UseAuth && c.SchemaUser == "" {
+		add("schema-user: required to read schema-prefix when use-auth is set")
+	}
+	if c.ServerTLSMinVersion != "1.2" && c.ServerTLSMinVersion != "1.3" {
+		add("server-tls-min-version: unknown version %q, expected 1.2 or 1.3", c.ServerTLSMinVersion)
+	}
+	for name, path := range map[string]string{
+		"ca-file":               c.CaFile,
+		"cert-file":             c.CertFile,
+		"key-file":              c.KeyFile,
+		"schema-file":           c.SchemaFile,
+		"server-cert-file":      c.ServerCertFile,
+		"server-key-file":       c.ServerKeyFile,
+		"server-client-ca-file": c.ServerClientCaFile,
+	} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			add("%s: %v", name, err)
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
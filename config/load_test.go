@@ -0,0 +1,82 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// setenv sets an environment variable for the duration of the test.
+func setenv(t *testing.T, name, value string) {
+	old, ok := os.LookupEnv(name)
+	os.Setenv(name, value)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(name, old)
+		} else {
+			os.Unsetenv(name)
+		}
+	})
+}
+
+// writeFile writes a configuration file in the test's directory.
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	for _, env := range []string{"LOG_LEVEL", "ADMIN_USERS", "MAX_TXN_OPS", "SEPARATOR", "PORT", ConfigFileEnv} {
+		setenv(t, env, "")
+	}
+	path := writeFile(t, "config.yaml", "log-level: warn\nadmin-users: file\nmax-txn-ops: 10\n")
+	setenv(t, "LOG_LEVEL", "error")
+	setenv(t, "ADMIN_USERS", "env")
+
+	settings, err := Load(NewFlagSet("test"), []string{"-config", path, "-log-level", "debug"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := GetConfig()
+	if c.LogLevel != "debug" || c.AdminUsers != "env" || c.MaxTxnOps != 10 || c.Separator != "/" {
+		t.Errorf("config = %+v, want log-level debug, admin-users env, max-txn-ops 10 and separator /", c)
+	}
+
+	want := map[string]string{
+		"log-level":   SourceFlag,
+		"admin-users": SourceEnv,
+		"max-txn-ops": SourceFile,
+		"separator":   SourceDefault,
+	}
+	for _, s := range settings {
+		if source, ok := want[s.Name]; ok && s.Source != source {
+			t.Errorf("source of %s = %s, want %s", s.Name, s.Source, source)
+		}
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	setenv(t, "MAX_TXN_OPS", "")
+	path := writeFile(t, "config.json", `{"max-txn-ops": "many", "colour": "blue"}`)
+	before := GetConfig()
+	_, err := Load(NewFlagSet("test"), []string{"-config", path})
+	e, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("Load = %v, want an *Error", err)
+	}
+	want := []string{
+		path + `: max-txn-ops: invalid integer "many"`,
+		path + ": unknown setting colour",
+	}
+	if !reflect.DeepEqual(e.Problems, want) {
+		t.Errorf("problems = %q, want %q", e.Problems, want)
+	}
+	if GetConfig() != before {
+		t.Error("Load replaced the configuration despite the error")
+	}
+}
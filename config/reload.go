@@ -0,0 +1,112 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	reloadMu sync.Mutex
+	hooks    []func(old, new *AppConfig)
+)
+
+// OnReload registers fn to run after every reload, with the previous and the
+// new configuration.
+func OnReload(fn func(old, new *AppConfig)) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	hooks = append(hooks, fn)
+}
+
+// Reload reads the configuration again with the flags fs was parsed with by
+// Load and replaces the current one. Settings that can only change with a
+// restart keep their value and are logged. An invalid configuration is
+// returned as an error and leaves the current one in place.
+func Reload(fs *flag.FlagSet) error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	c, _, err := build(fs)
+	if err != nil {
+		return err
+	}
+	old := GetConfig()
+	oldValue, newValue := reflect.ValueOf(old).Elem(), reflect.ValueOf(c).Elem()
+	var changed []string
+	for _, f := range fields() {
+		if reflect.DeepEqual(oldValue.Field(f.index).Interface(), newValue.Field(f.index).Interface()) {
+			continue
+		}
+		if f.restart {
+			zap.L().Warn("config: setting changed, restart etcdkeeper to apply it", zap.String("setting", f.name))
+			newValue.Field(f.index).Set(oldValue.Field(f.index))
+			continue
+		}
+		changed = append(changed, f.name)
+	}
+	current.Store(c)
+	if len(changed) > 0 {
+		zap.L().Info("config: reloaded", zap.Strings("settings", changed))
+	}
+	for _, fn := range hooks {
+		fn(old, c)
+	}
+	return nil
+}
+
+// Watch reloads the configuration whenever the -config file or one of the
+// TLS files of the etcd client or of the server changes, checking every
+// RELOAD_INTERVAL until ctx is done. Certificates can thus be rotated in
+// place. Failed reloads are logged.
+func Watch(ctx context.Context, fs *flag.FlagSet) {
+	interval := GetConfig().ReloadInterval
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := fileStamps(fs)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		stamps := fileStamps(fs)
+		if bytes.Equal(stamps, last) {
+			continue
+		}
+		last = stamps
+		if err := Reload(fs); err != nil {
+			zap.L().Error("config: reload failed", zap.Error(err))
+		}
+	}
+}
+
+// fileStamps describes the size and modification time of the files Watch
+// follows, telling when one of them changed.
+func fileStamps(fs *flag.FlagSet) []byte {
+	c := GetConfig()
+	var b bytes.Buffer
+	for _, path := range []string{
+		fs.Lookup("config").Value.String(), c.CaFile, c.CertFile, c.KeyFile,
+		c.ServerCertFile, c.ServerKeyFile, c.ServerClientCaFile,
+	} {
+		if path == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "%s:", path)
+		if info, err := os.Stat(path); err == nil {
+			fmt.Fprintf(&b, "%d:%d", info.Size(), info.ModTime().UnixNano())
+		}
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestReloadKeepsRestartSettings(t *testing.T) {
+	for _, env := range []string{"LOG_LEVEL", "SEPARATOR", "PORT", "MAX_TXN_OPS", ConfigFileEnv} {
+		setenv(t, env, "")
+	}
+	path := writeFile(t, "config.toml", "port = 8081\nseparator = \":\"\nlog-level = \"warn\"\n")
+	fs := NewFlagSet("test")
+	if _, err := Load(fs, []string{"-config", path}); err != nil {
+		t.Fatal(err)
+	}
+
+	var hooked *AppConfig
+	OnReload(func(old, new *AppConfig) { hooked = new })
+	content := "port = 9090\nseparator = \"/\"\nlog-level = \"error\"\nmax-txn-ops = 7\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reload(fs); err != nil {
+		t.Fatal(err)
+	}
+	c := GetConfig()
+	if c.Port != 8081 || c.Separator != ":" {
+		t.Errorf("port, separator = %d, %q, want 8081, \":\" kept until a restart", c.Port, c.Separator)
+	}
+	if c.LogLevel != "error" || c.MaxTxnOps != 7 {
+		t.Errorf("log-level, max-txn-ops = %q, %d, want error, 7", c.LogLevel, c.MaxTxnOps)
+	}
+	if hooked != c {
+		t.Error("the reload hook did not get the new configuration")
+	}
+
+	// An invalid file leaves the configuration in place.
+	if err := ioutil.WriteFile(path, []byte("max-txn-ops = 0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reload(fs); err == nil {
+		t.Error("Reload accepted max-txn-ops = 0")
+	}
+	if GetConfig() != c {
+		t.Error("a failed Reload replaced the configuration")
+	}
+}
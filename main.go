@@ -3,29 +3,41 @@ package main
 import (
 	"context"
 	"embed"
+	"errors"
+	"flag"
 	"fmt"
 	"io/fs"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
-	"github.com/labstack/gommon/log"
 	"github.com/trinhdaiphuc/etcdkeeper/config"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/certs"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/etcd"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/logging"
 	"github.com/trinhdaiphuc/etcdkeeper/pkg/routers"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/version"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 //go:embed web
 var embededFiles embed.FS
 
-func init() {
-	config.Load()
+// webAssets returns the UI files.
+func webAssets() fs.FS {
+	fsys, err := fs.Sub(embededFiles, "web")
+	if err != nil {
+		panic(err)
+	}
+	return fsys
 }
 
 func getFileSystem(dirName string) http.FileSystem {
-	log.Print("using embed mode")
 	fsys, err := fs.Sub(embededFiles, "web"+dirName)
 	if err != nil {
 		panic(err)
@@ -35,15 +47,75 @@ func getFileSystem(dirName string) http.FileSystem {
 }
 
 func main() {
-	// Setup
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	fs := config.NewFlagSet("etcdkeeper")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage: etcdkeeper [command] [flags]\n\nCommands:\n")
+		fmt.Fprintf(out, "  serve         run the server (default)\n")
+		fmt.Fprintf(out, "  check-config  validate the configuration and print the settings with their source\n")
+		fmt.Fprintf(out, "  version       print the version\n\n")
+		fmt.Fprintf(out, "Flags take precedence over the environment, which takes precedence over the -config file.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+
+	switch command {
+	case "serve":
+		_, err := config.Load(fs, args)
+		exitOnError(err)
+		serve(fs)
+	case "check-config":
+		settings, err := config.Load(fs, args)
+		exitOnError(err)
+		for _, s := range settings {
+			fmt.Println(s)
+		}
+		fmt.Println("configuration is valid")
+	case "version":
+		fmt.Println("etcdkeeper", version.Get())
+	default:
+		fmt.Fprintf(os.Stderr, "etcdkeeper: unknown command %s\n", command)
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
+// exitOnError exits when the configuration could not be loaded. The flag
+// package already printed its own errors along with the usage.
+func exitOnError(err error) {
+	var cerr *config.Error
+	switch {
+	case err == nil:
+		return
+	case errors.Is(err, flag.ErrHelp):
+		os.Exit(0)
+	case errors.As(err, &cerr):
+		fmt.Fprintf(os.Stderr, "etcdkeeper: %v\n", err)
+	}
+	os.Exit(2)
+}
+
+func serve(fs *flag.FlagSet) {
 	cfg := config.GetConfig()
-	e := echo.New()
+	logger := logging.Setup(cfg)
+	defer logger.Sync()
+	logger.Info("starting etcdkeeper", zap.Stringer("version", version.Get()))
 
-	e.Logger.SetLevel(log.INFO)
-	e.Use(middleware.Logger())
+	// Echo and net/http log the errors they cannot return through the
+	// structured logger too.
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	echoLog, _ := zap.NewStdLogAt(logger.Named("echo"), zapcore.ErrorLevel)
+	e.Logger.SetHeader("${level}")
+	e.Logger.SetOutput(echoLog.Writer())
+	e.StdLogger, _ = zap.NewStdLogAt(logger.Named("http"), zapcore.WarnLevel)
 
 	// Set up routers
-	routers.SetRoutes(e)
+	routers.SetRoutes(e, webAssets())
 
 	// Set up static files
 	assetHandler := func(dirName string) http.Handler {
@@ -52,10 +124,53 @@ func main() {
 	e.GET("/", echo.WrapHandler(assetHandler("")))
 	e.GET("/static/*", echo.WrapHandler(http.StripPrefix("/static/", assetHandler("/static"))))
 
-	// Start server
+	// Start server, over HTTPS when a certificate is configured. Rotated
+	// certificates are picked up on reload, switching between HTTP and HTTPS
+	// needs a restart.
+	addr := fmt.Sprintf("%v:%d", cfg.Host, cfg.Port)
+	start := func() error { return e.Start(addr) }
+	if cfg.ServerCertFile != "" {
+		serverCerts, err := certs.Load(cfg)
+		if err != nil {
+			logger.Fatal("loading the server certificate", zap.Error(err))
+		}
+		e.TLSServer.Addr = addr
+		e.TLSServer.TLSConfig = serverCerts.TLSConfig()
+		start = func() error { return e.StartServer(e.TLSServer) }
+		config.OnReload(func(old, new *config.AppConfig) {
+			if new.ServerCertFile == "" {
+				logger.Warn("config: server-cert-file removed, restart etcdkeeper to serve HTTP")
+				return
+			}
+			if err := serverCerts.Reload(new); err != nil {
+				logger.Error("config: reload failed, keeping the previous certificates", zap.Error(err))
+			}
+		})
+	} else {
+		config.OnReload(func(old, new *config.AppConfig) {
+			if new.ServerCertFile != "" {
+				logger.Warn("config: server-cert-file set, restart etcdkeeper to serve HTTPS")
+			}
+		})
+	}
+	go func() {
+		logger.Info("listening", zap.String("address", addr), zap.Bool("tls", cfg.ServerCertFile != ""))
+		if err := start(); err != nil && err != http.ErrServerClosed {
+			logger.Fatal("shutting down the server", zap.Error(err))
+		}
+	}()
+
+	// Reload the configuration when its files change or on SIGHUP.
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	go config.Watch(watchCtx, fs)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
 	go func() {
-		if err := e.Start(fmt.Sprintf("%v:%d", cfg.Host, cfg.Port)); err != nil && err != http.ErrServerClosed {
-			e.Logger.Fatal("shutting down the server")
+		for range hup {
+			if err := config.Reload(fs); err != nil {
+				logger.Error("config: reload failed", zap.Error(err))
+			}
 		}
 	}()
 
@@ -67,6 +182,7 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	if err := e.Shutdown(ctx); err != nil {
-		e.Logger.Fatal(err)
+		logger.Error("shutting down the server", zap.Error(err))
 	}
+	etcd.ClosePools()
 }
@@ -0,0 +1,248 @@
+package apiv1
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/apiv1/types"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/audit"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/etcd"
+)
+
+func GetCluster(ctx echo.Context) error {
+	if err := authorize(ctx, "", false); err != nil {
+		return err
+	}
+	cli, err := userClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Release()
+
+	status, err := etcd.GetClusterStatusV3(ctx.Request().Context(), cli)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(http.StatusOK, status)
+}
+
+func AddMember(ctx echo.Context) error {
+	var req types.AddMemberRequest
+	if err := ctx.Bind(&req); err != nil {
+		return err
+	}
+	if len(req.PeerURLs) == 0 {
+		return invalidArgument("peerURLs is required")
+	}
+	if err := confirm(req.Confirm, req.PeerURLs[0], "the first peer URL of the new member"); err != nil {
+		return err
+	}
+	cli, err := userClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Release()
+
+	member, members, err := etcd.AddMemberV3(ctx.Request().Context(), cli, req.PeerURLs, req.Learner)
+	audit.Record(ctx, "member.add", map[string]interface{}{"peerURLs": req.PeerURLs, "learner": req.Learner}, err)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(http.StatusCreated, types.AddMemberResponse{Member: member, Members: members})
+}
+
+func RemoveMember(ctx echo.Context) error {
+	return memberOp(ctx, "member.remove", func(cli *etcd.ClientV3, id uint64, _ types.MemberRequest) ([]etcd.Member, error) {
+		return etcd.RemoveMemberV3(ctx.Request().Context(), cli, id)
+	})
+}
+
+func UpdateMember(ctx echo.Context) error {
+	return memberOp(ctx, "member.update", func(cli *etcd.ClientV3, id uint64, req types.MemberRequest) ([]etcd.Member, error) {
+		if len(req.PeerURLs) == 0 {
+			return nil, invalidArgument("peerURLs is required")
+		}
+		return etcd.UpdateMemberV3(ctx.Request().Context(), cli, id, req.PeerURLs)
+	})
+}
+
+func PromoteMember(ctx echo.Context) error {
+	return memberOp(ctx, "member.promote", func(cli *etcd.ClientV3, id uint64, _ types.MemberRequest) ([]etcd.Member, error) {
+		return etcd.PromoteMemberV3(ctx.Request().Context(), cli, id)
+	})
+}
+
+// memberOp runs an operation on the member of the path once the request has
+// confirmed it by repeating the member ID.
+func memberOp(ctx echo.Context, action string, op func(cli *etcd.ClientV3, id uint64, req types.MemberRequest) ([]etcd.Member, error)) error {
+	var req types.MemberRequest
+	if err := ctx.Bind(&req); err != nil {
+		return err
+	}
+	memberID := ctx.Param("id")
+	id, err := etcd.ParseID(memberID)
+	if err != nil {
+		return invalidArgument("invalid member id %s", memberID)
+	}
+	if err = confirm(req.Confirm, memberID, "the member id"); err != nil {
+		return err
+	}
+	cli, err := userClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Release()
+
+	members, err := op(cli, id, req)
+	if _, invalid := err.(*types.Error); invalid {
+		return err
+	}
+	params := map[string]interface{}{"id": etcd.FormatID(id)}
+	if len(req.PeerURLs) > 0 {
+		params["peerURLs"] = req.PeerURLs
+	}
+	audit.Record(ctx, action, params, err)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(http.StatusOK, types.MembersResponse{Members: members})
+}
+
+func Compact(ctx echo.Context) error {
+	var req types.CompactRequest
+	if err := ctx.Bind(&req); err != nil {
+		return err
+	}
+	if req.Revision <= 0 {
+		return invalidArgument("revision must be a positive integer")
+	}
+	if err := confirm(req.Confirm, strconv.FormatInt(req.Revision, 10), "the revision"); err != nil {
+		return err
+	}
+	cli, err := userClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Release()
+
+	current, err := etcd.CompactV3(ctx.Request().Context(), cli, req.Revision, req.Physical)
+	audit.Record(ctx, "compact", map[string]interface{}{"revision": req.Revision, "physical": req.Physical}, err)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(http.StatusOK, types.CompactResponse{Revision: req.Revision, CurrentRevision: current})
+}
+
+func Defragment(ctx echo.Context) error {
+	var req types.DefragmentRequest
+	if err := ctx.Bind(&req); err != nil {
+		return err
+	}
+	id, err := etcd.ParseID(req.ID)
+	if err != nil {
+		return invalidArgument("invalid member id %s", req.ID)
+	}
+	if err = confirm(req.Confirm, req.ID, "the member id"); err != nil {
+		return err
+	}
+	cli, err := userClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Release()
+
+	status, err := etcd.DefragmentV3(ctx.Request().Context(), cli, id)
+	audit.Record(ctx, "defragment", map[string]interface{}{"id": etcd.FormatID(id)}, err)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(http.StatusOK, status)
+}
+
+func ListAlarms(ctx echo.Context) error {
+	cli, err := userClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Release()
+
+	alarms, err := etcd.ListAlarmsV3(ctx.Request().Context(), cli)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(http.StatusOK, types.AlarmsResponse{Alarms: alarms})
+}
+
+// DisarmAlarm disarms alarms and returns the ones it disarmed.
+func DisarmAlarm(ctx echo.Context) error {
+	var (
+		req types.DisarmRequest
+		id  uint64
+		err error
+	)
+	if err = ctx.Bind(&req); err != nil {
+		return err
+	}
+	if req.ID != "" {
+		if id, err = etcd.ParseID(req.ID); err != nil {
+			return invalidArgument("invalid member id %s", req.ID)
+		}
+	}
+	alarm, err := etcd.ParseAlarm(req.Alarm)
+	if err != nil {
+		return invalidArgument("%v", err)
+	}
+	target := "all"
+	if req.ID != "" || req.Alarm != "" {
+		target = alarm.String()
+	}
+	if err = confirm(req.Confirm, target, target); err != nil {
+		return err
+	}
+	cli, err := userClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Release()
+
+	alarms, err := etcd.DisarmAlarmV3(ctx.Request().Context(), cli, id, alarm)
+	audit.Record(ctx, "alarm.disarm", map[string]interface{}{"id": req.ID, "alarm": target}, err)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(http.StatusOK, types.AlarmsResponse{Alarms: alarms})
+}
+
+// Snapshot streams a snapshot of the backend database of the member the
+// client is connected to.
+func Snapshot(ctx echo.Context) error {
+	cli, err := userClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Release()
+
+	rc, err := etcd.SnapshotV3(ctx.Request().Context(), cli)
+	audit.Record(ctx, "snapshot", nil, err)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	filename := fmt.Sprintf("etcd-snapshot-%s.db", time.Now().UTC().Format("20060102T150405Z"))
+	ctx.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	return ctx.Stream(http.StatusOK, echo.MIMEOctetStream, rc)
+}
+
+// confirm checks that a destructive operation repeats its target, described
+// by what in the error.
+func confirm(value, target, what string) error {
+	if target == "" || strings.TrimSpace(value) != target {
+		return newError(http.StatusPreconditionRequired, types.CodeFailedPrecondition, "confirm must be set to %s", what)
+	}
+	return nil
+}
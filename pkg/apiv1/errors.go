@@ -0,0 +1,134 @@
+package apiv1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/apiv1/types"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/schemas"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newError(status int, code, format string, args ...interface{}) *types.Error {
+	return &types.Error{Status: status, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func invalidArgument(format string, args ...interface{}) *types.Error {
+	return newError(http.StatusBadRequest, types.CodeInvalidArgument, format, args...)
+}
+
+func notFound(format string, args ...interface{}) *types.Error {
+	return newError(http.StatusNotFound, types.CodeNotFound, format, args...)
+}
+
+// etcdErrors maps etcd errors whose gRPC code does not tell the HTTP status.
+var etcdErrors = map[error]*types.Error{
+	rpctypes.ErrAuthFailed:       {Status: http.StatusUnauthorized, Code: types.CodeUnauthenticated},
+	rpctypes.ErrInvalidAuthToken: {Status: http.StatusUnauthorized, Code: types.CodeUnauthenticated},
+	rpctypes.ErrUserEmpty:        {Status: http.StatusUnauthorized, Code: types.CodeUnauthenticated},
+	rpctypes.ErrPermissionDenied: {Status: http.StatusForbidden, Code: types.CodePermissionDenied},
+	rpctypes.ErrUserNotFound:     {Status: http.StatusNotFound, Code: types.CodeNotFound},
+	rpctypes.ErrMemberExist:      {Status: http.StatusConflict, Code: types.CodeAlreadyExists},
+	rpctypes.ErrPeerURLExist:     {Status: http.StatusConflict, Code: types.CodeAlreadyExists},
+	rpctypes.ErrLeaseExist:       {Status: http.StatusConflict, Code: types.CodeAlreadyExists},
+	rpctypes.ErrCompacted:        {Status: http.StatusGone, Code: types.CodeOutOfRange},
+	rpctypes.ErrFutureRev:        {Status: http.StatusBadRequest, Code: types.CodeOutOfRange},
+	rpctypes.ErrLeaseTTLTooLarge: {Status: http.StatusBadRequest, Code: types.CodeOutOfRange},
+	rpctypes.ErrNoSpace:          {Status: http.StatusInsufficientStorage, Code: types.CodeResourceExhausted},
+	rpctypes.ErrRequestTooLarge:  {Status: http.StatusRequestEntityTooLarge, Code: types.CodeInvalidArgument},
+	rpctypes.ErrTooManyRequests:  {Status: http.StatusTooManyRequests, Code: types.CodeResourceExhausted},
+	rpctypes.ErrNotLeader:        {Status: http.StatusServiceUnavailable, Code: types.CodeUnavailable},
+	rpctypes.ErrMemberNotLearner: {Status: http.StatusConflict, Code: types.CodeFailedPrecondition},
+	rpctypes.ErrTooManyLearners:  {Status: http.StatusConflict, Code: types.CodeFailedPrecondition},
+	rpctypes.ErrAuthNotEnabled:   {Status: http.StatusConflict, Code: types.CodeFailedPrecondition},
+	rpctypes.ErrRootUserNotExist: {Status: http.StatusConflict, Code: types.CodeFailedPrecondition},
+	rpctypes.ErrRoleNotGranted:   {Status: http.StatusForbidden, Code: types.CodePermissionDenied},
+}
+
+// grpcCodes maps gRPC codes to the HTTP status and envelope code.
+var grpcCodes = map[codes.Code]*types.Error{
+	codes.InvalidArgument:    {Status: http.StatusBadRequest, Code: types.CodeInvalidArgument},
+	codes.NotFound:           {Status: http.StatusNotFound, Code: types.CodeNotFound},
+	codes.AlreadyExists:      {Status: http.StatusConflict, Code: types.CodeAlreadyExists},
+	codes.PermissionDenied:   {Status: http.StatusForbidden, Code: types.CodePermissionDenied},
+	codes.Unauthenticated:    {Status: http.StatusUnauthorized, Code: types.CodeUnauthenticated},
+	codes.FailedPrecondition: {Status: http.StatusPreconditionFailed, Code: types.CodeFailedPrecondition},
+	codes.OutOfRange:         {Status: http.StatusBadRequest, Code: types.CodeOutOfRange},
+	codes.ResourceExhausted:  {Status: http.StatusTooManyRequests, Code: types.CodeResourceExhausted},
+	codes.Unavailable:        {Status: http.StatusServiceUnavailable, Code: types.CodeUnavailable},
+	codes.DeadlineExceeded:   {Status: http.StatusGatewayTimeout, Code: types.CodeDeadlineExceeded},
+	codes.Canceled:           {Status: http.StatusServiceUnavailable, Code: types.CodeUnavailable},
+}
+
+// fromError turns any error returned by a handler into an Error.
+func fromError(err error) *types.Error {
+	var (
+		apiErr  *types.Error
+		httpErr *echo.HTTPError
+		valErr  *schemas.ValidationError
+	)
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.Is(err, middleware.ErrJWTMissing):
+		// The JWT middleware answers 400 to requests without a token.
+		return newError(http.StatusUnauthorized, types.CodeUnauthenticated, "%v", middleware.ErrJWTMissing.Message)
+	case errors.As(err, &httpErr):
+		code := types.CodeInternal
+		switch httpErr.Code {
+		case http.StatusBadRequest:
+			code = types.CodeInvalidArgument
+		case http.StatusUnauthorized:
+			code = types.CodeUnauthenticated
+		case http.StatusForbidden:
+			code = types.CodePermissionDenied
+		case http.StatusNotFound, http.StatusMethodNotAllowed:
+			code = types.CodeNotFound
+		}
+		return &types.Error{Status: httpErr.Code, Code: code, Message: fmt.Sprint(httpErr.Message)}
+	case errors.As(err, &valErr):
+		return &types.Error{
+			Status:  http.StatusUnprocessableEntity,
+			Code:    types.CodeValidationFailed,
+			Message: valErr.Error(),
+			Details: valErr,
+		}
+	case errors.Is(err, context.DeadlineExceeded):
+		return newError(http.StatusGatewayTimeout, types.CodeDeadlineExceeded, "%v", err)
+	}
+
+	ev := rpctypes.Error(err)
+	if mapped, ok := etcdErrors[ev]; ok {
+		return &types.Error{Status: mapped.Status, Code: mapped.Code, Message: ev.Error()}
+	}
+	if etcdErr, ok := ev.(rpctypes.EtcdError); ok {
+		if mapped, ok := grpcCodes[etcdErr.Code()]; ok {
+			return &types.Error{Status: mapped.Status, Code: mapped.Code, Message: etcdErr.Error()}
+		}
+	}
+	if s, ok := status.FromError(err); ok {
+		if mapped, ok := grpcCodes[s.Code()]; ok {
+			return &types.Error{Status: mapped.Status, Code: mapped.Code, Message: s.Message()}
+		}
+	}
+	return newError(http.StatusInternalServerError, types.CodeInternal, "%v", err)
+}
+
+// Errors writes the errors returned by the handlers of the group, and by
+// the middlewares after it, in the error envelope.
+func Errors(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		err := next(c)
+		if err == nil || c.Response().Committed {
+			return err
+		}
+		apiErr := fromError(err)
+		return c.JSON(apiErr.Status, types.ErrorResponse{Error: apiErr})
+	}
+}
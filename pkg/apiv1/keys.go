@@ -0,0 +1,393 @@
+package apiv1
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/trinhdaiphuc/etcdkeeper/config"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/apiv1/types"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/etcd"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/formats"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/middlewares"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/protos"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/schemas"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	defaultListLimit   = 1000
+	defaultSearchLimit = 100
+)
+
+// Connect checks the credentials against the cluster and returns a token
+// for it. With etcd auth enabled only root may log in, as on the legacy
+// endpoints.
+func Connect(ctx echo.Context) error {
+	var req types.ConnectRequest
+	if err := ctx.Bind(&req); err != nil {
+		return err
+	}
+	host := strings.TrimSpace(req.Host)
+	if host == "" {
+		return invalidArgument("host is required")
+	}
+	if !strings.HasPrefix(host, "http") {
+		host = "http://" + host
+	}
+	if config.GetConfig().UseAuth {
+		if req.Username == "" || req.Password == "" {
+			return newError(http.StatusUnauthorized, types.CodeUnauthenticated, "username and password are required")
+		}
+		if req.Username != "root" {
+			return newError(http.StatusForbidden, types.CodePermissionDenied, "only root may log in")
+		}
+	}
+
+	user := &etcd.UserInfo{Host: host, Username: req.Username, Password: req.Password}
+	cli, err := etcd.GetClientV3(*user)
+	if err != nil {
+		return err
+	}
+	defer cli.Release()
+
+	info, err := etcd.GetInfoV3(ctx.Request().Context(), cli)
+	if err != nil {
+		return err
+	}
+	token, err := middlewares.NewToken(user)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(http.StatusOK, types.ConnectResponse{Token: token, Info: info})
+}
+
+func GetKey(ctx echo.Context) error {
+	var req types.GetKeyRequest
+	if err := ctx.Bind(&req); err != nil {
+		return err
+	}
+	if req.Key == "" {
+		return invalidArgument("key is required")
+	}
+	if err := authorize(ctx, req.Key, false); err != nil {
+		return err
+	}
+	encoding, err := types.ParseEncoding(req.Encoding, types.EncodingAuto)
+	if err != nil {
+		return invalidArgument("%v", err)
+	}
+	cli, err := userClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Release()
+
+	kv, err := getKey(ctx, cli, req.Key, encoding)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(http.StatusOK, kv)
+}
+
+// ListKeys lists the keys starting with prefix in key order, every key when
+// prefix is empty. Count is the number of keys left from after on.
+func ListKeys(ctx echo.Context) error {
+	req := types.ListKeysRequest{Limit: defaultListLimit}
+	if err := ctx.Bind(&req); err != nil {
+		return err
+	}
+	if req.Limit <= 0 {
+		return invalidArgument("limit must be a positive integer")
+	}
+	if req.Revision < 0 {
+		return invalidArgument("revision must not be negative")
+	}
+	if err := authorize(ctx, req.Prefix, false); err != nil {
+		return err
+	}
+	encoding, err := types.ParseEncoding(req.Encoding, types.EncodingAuto)
+	if err != nil {
+		return invalidArgument("%v", err)
+	}
+	cli, err := userClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Release()
+
+	from := req.Prefix
+	opts := []clientv3.OpOption{clientv3.WithPrefix(), clientv3.WithLimit(req.Limit)}
+	if req.After != "" {
+		if !strings.HasPrefix(req.After, req.Prefix) {
+			return invalidArgument("after must start with the prefix")
+		}
+		from = req.After + "\x00"
+		opts[0] = clientv3.WithRange(clientv3.GetPrefixRangeEnd(req.Prefix))
+	}
+	if req.KeysOnly {
+		opts = append(opts, clientv3.WithKeysOnly())
+	}
+	if req.Revision > 0 {
+		opts = append(opts, clientv3.WithRev(req.Revision))
+	}
+	resp, err := cli.Get(ctx.Request().Context(), from, opts...)
+	if err != nil {
+		return err
+	}
+	list := types.ListKeysResponse{
+		Kvs:      make([]types.KeyValue, 0, len(resp.Kvs)),
+		Count:    resp.Count,
+		More:     resp.More,
+		Revision: resp.Header.Revision,
+	}
+	if req.Revision > 0 {
+		list.Revision = req.Revision
+	}
+	for _, kv := range resp.Kvs {
+		list.Kvs = append(list.Kvs, newKeyValue(kv, encoding))
+	}
+	return ctx.JSON(http.StatusOK, list)
+}
+
+// PutKey writes a key and returns it as stored. Values failing their schema
+// are rejected with 422 and the violations in the details.
+func PutKey(ctx echo.Context) error {
+	var req types.PutKeyRequest
+	if err := ctx.Bind(&req); err != nil {
+		return err
+	}
+	if req.Key == "" {
+		return invalidArgument("key is required")
+	}
+	if err := authorize(ctx, req.Key, true); err != nil {
+		return err
+	}
+	encoding, err := types.ParseEncoding(req.Encoding, types.EncodingAuto)
+	if err != nil {
+		return invalidArgument("%v", err)
+	}
+	var value []byte
+	if req.ProtoJSON {
+		md, ok := protos.Default().Lookup(req.Key)
+		if !ok {
+			return invalidArgument("key %s is not mapped to a message type", req.Key)
+		}
+		value, err = protos.FromJSON(md, []byte(req.Value))
+	} else {
+		value, err = types.DecodeValue(req.Value, encoding)
+	}
+	if err != nil {
+		return invalidArgument("%v", err)
+	}
+	if encoding == types.EncodingText {
+		encoding = types.EncodingAuto
+	}
+	lease := etcd.PutLease{TTL: req.TTL, Detach: req.Detach}
+	if req.Lease != "" {
+		id, err := etcd.ParseID(req.Lease)
+		if err != nil {
+			return invalidArgument("invalid lease id %s", req.Lease)
+		}
+		lease.ID = int64(id)
+	}
+	if err = lease.Check(); err != nil {
+		return invalidArgument("%v", err)
+	}
+
+	cli, err := userClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Release()
+
+	list, err := schemas.ForV3(ctx.Request().Context(), cli.Host)
+	if err != nil {
+		return err
+	}
+	if err = schemas.Validate(list, req.Key, value); err != nil {
+		var verr *schemas.ValidationError
+		if errors.As(err, &verr) {
+			return err
+		}
+		return invalidArgument("%v", err)
+	}
+	if format := formats.ForKey(req.Key); req.ValidateFormat && format != "" {
+		if err = formats.Validate(format, value); err != nil {
+			return invalidArgument("%v", err)
+		}
+	}
+
+	if err = etcd.PutV3(ctx.Request().Context(), cli, req.Key, string(value), lease); err != nil {
+		return err
+	}
+	kv, err := getKey(ctx, cli, req.Key, encoding)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(http.StatusOK, kv)
+}
+
+// DeleteKey deletes a key, or every key starting with it when prefix is
+// set. Deleting a single key that does not exist is a 404.
+func DeleteKey(ctx echo.Context) error {
+	var req types.DeleteKeyRequest
+	if err := ctx.Bind(&req); err != nil {
+		return err
+	}
+	if req.Key == "" {
+		return invalidArgument("key is required")
+	}
+	if err := authorize(ctx, req.Key, true); err != nil {
+		return err
+	}
+	cli, err := userClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Release()
+
+	var opts []clientv3.OpOption
+	if req.Prefix {
+		opts = append(opts, clientv3.WithPrefix())
+	}
+	resp, err := cli.Delete(ctx.Request().Context(), req.Key, opts...)
+	if err != nil {
+		return err
+	}
+	if resp.Deleted == 0 && !req.Prefix {
+		return notFound("key %s does not exist", req.Key)
+	}
+	return ctx.JSON(http.StatusOK, types.DeleteKeyResponse{Deleted: resp.Deleted, Revision: resp.Header.Revision})
+}
+
+// ListChildren lists the immediate children of a node of the key tree the
+// user may read, a page at a time.
+func ListChildren(ctx echo.Context) error {
+	separator := config.GetConfig().Separator
+	req := types.ChildrenRequest{Key: separator, Limit: etcd.DefaultChildLimit}
+	if err := ctx.Bind(&req); err != nil {
+		return err
+	}
+	if req.Limit <= 0 {
+		return invalidArgument("limit must be a positive integer")
+	}
+	prefix := etcd.ChildrenPrefix(req.Key, separator)
+	if err := authorize(ctx, scopeKey(prefix, separator), false); err != nil {
+		return err
+	}
+	user, cli, err := userAndClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Release()
+
+	permissions, err := etcd.GetPermissionPrefix(ctx.Request().Context(), *user, req.Key)
+	if err != nil {
+		return err
+	}
+	ranges := etcd.SearchRanges(permissions, prefix, separator)
+	page, err := etcd.ListChildrenV3(ctx.Request().Context(), cli, req.Key, separator, ranges, req.After, req.Limit)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(http.StatusOK, page)
+}
+
+// Search searches the keys under key the user may read, see types.SearchRequest.
+func Search(ctx echo.Context) error {
+	separator := config.GetConfig().Separator
+	req := types.SearchRequest{Key: separator, Limit: defaultSearchLimit}
+	if err := ctx.Bind(&req); err != nil {
+		return err
+	}
+	if req.Limit <= 0 {
+		return invalidArgument("limit must be a positive integer")
+	}
+	query, err := etcd.ParseSearchQuery(req.Pattern, req.Mode, req.Value, req.ValueMode, req.IgnoreCase, separator)
+	if err != nil {
+		return invalidArgument("%v", err)
+	}
+	query.Limit = req.Limit
+	if err = authorize(ctx, scopeKey(req.Key, separator), false); err != nil {
+		return err
+	}
+
+	user, cli, err := userAndClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Release()
+
+	permissions, err := etcd.GetPermissionPrefix(ctx.Request().Context(), *user, req.Key)
+	if err != nil {
+		return err
+	}
+	query.Ranges = etcd.SearchRanges(permissions, req.Key, separator)
+	resp, err := etcd.SearchV3(ctx.Request().Context(), cli, query)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(http.StatusOK, resp)
+}
+
+// getKey reads key with the TTL of its lease, 404 when it does not exist.
+func getKey(ctx echo.Context, cli *etcd.ClientV3, key, encoding string) (*types.KeyValue, error) {
+	resp, err := cli.Get(ctx.Request().Context(), key)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Count == 0 {
+		return nil, notFound("key %s does not exist", key)
+	}
+	kv := newKeyValue(resp.Kvs[0], encoding)
+	if resp.Kvs[0].Lease != 0 {
+		kv.TTL = etcd.GetTTL(ctx.Request().Context(), cli, resp.Kvs[0].Lease)
+	}
+	return &kv, nil
+}
+
+// newKeyValue converts kv, with the JSON rendering of its value when the key
+// is mapped to a protobuf message type.
+func newKeyValue(kv *mvccpb.KeyValue, encoding string) types.KeyValue {
+	v := types.KeyValue{
+		Key:            string(kv.Key),
+		CreateRevision: kv.CreateRevision,
+		ModRevision:    kv.ModRevision,
+		Version:        kv.Version,
+		Binary:         types.IsBinary(kv.Value),
+	}
+	v.Value, v.Encoding = types.EncodeValue(kv.Value, encoding)
+	if kv.Lease != 0 {
+		v.Lease = etcd.FormatID(uint64(kv.Lease))
+	}
+	if md, ok := protos.Default().Lookup(v.Key); ok && len(kv.Value) > 0 {
+		v.Message = string(md.FullName())
+		if data, err := protos.ToJSON(md, kv.Value); err != nil {
+			v.JSONError = err.Error()
+		} else {
+			v.JSON = string(data)
+		}
+	}
+	return v
+}
+
+// userClient leases a v3 client for the logged in user of the request.
+func userClient(ctx echo.Context) (*etcd.ClientV3, error) {
+	_, cli, err := userAndClient(ctx)
+	return cli, err
+}
+
+func userAndClient(ctx echo.Context) (*etcd.UserInfo, *etcd.ClientV3, error) {
+	user, ok := middlewares.GetUserInfo(ctx)
+	if !ok {
+		return nil, nil, newError(http.StatusUnauthorized, types.CodeUnauthenticated, "missing user info, log in again")
+	}
+	cli, err := etcd.GetClientV3(*user)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, cli, nil
+}
@@ -0,0 +1,107 @@
+package apiv1
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/apiv1/types"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/audit"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/etcd"
+)
+
+// ListLeases lists the leases of the cluster, with their keys when keys is
+// set.
+func ListLeases(ctx echo.Context) error {
+	withKeys, _ := strconv.ParseBool(ctx.QueryParam("keys"))
+	if err := authorize(ctx, "", false); err != nil {
+		return err
+	}
+	cli, err := userClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Release()
+
+	leases, err := etcd.ListLeasesV3(ctx.Request().Context(), cli, withKeys)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(http.StatusOK, types.LeasesResponse{Leases: leases})
+}
+
+func GetLease(ctx echo.Context) error {
+	id, err := leaseID(ctx)
+	if err != nil {
+		return err
+	}
+	if err = authorize(ctx, "", false); err != nil {
+		return err
+	}
+	cli, err := userClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Release()
+
+	lease, err := etcd.GetLeaseV3(ctx.Request().Context(), cli, id)
+	if err != nil {
+		return err
+	}
+	if lease.TTL == -1 {
+		return notFound("lease %s does not exist", lease.ID)
+	}
+	return ctx.JSON(http.StatusOK, lease)
+}
+
+func RevokeLease(ctx echo.Context) error {
+	id, err := leaseID(ctx)
+	if err != nil {
+		return err
+	}
+	if err = authorize(ctx, "", true); err != nil {
+		return err
+	}
+	cli, err := userClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Release()
+
+	err = etcd.RevokeLeaseV3(ctx.Request().Context(), cli, id)
+	audit.Record(ctx, "lease.revoke", map[string]interface{}{"id": etcd.FormatID(uint64(id))}, err)
+	if err != nil {
+		return err
+	}
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+func KeepAliveLease(ctx echo.Context) error {
+	id, err := leaseID(ctx)
+	if err != nil {
+		return err
+	}
+	if err = authorize(ctx, "", true); err != nil {
+		return err
+	}
+	cli, err := userClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Release()
+
+	ttl, err := etcd.KeepAliveOnceV3(ctx.Request().Context(), cli, id)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(http.StatusOK, types.KeepAliveResponse{ID: etcd.FormatID(uint64(id)), TTL: ttl})
+}
+
+// leaseID parses the hexadecimal lease ID of the path.
+func leaseID(ctx echo.Context) (int64, error) {
+	id, err := etcd.ParseID(ctx.Param("id"))
+	if err != nil {
+		return 0, invalidArgument("invalid lease id %s", ctx.Param("id"))
+	}
+	return int64(id), nil
+}
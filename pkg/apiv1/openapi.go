@@ -0,0 +1,20 @@
+package apiv1
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// spec is the OpenAPI 3 document of the API, keep it in sync with SetRoutes
+// and pkg/apiv1/types. The tests of pkg/routers check the routes and the
+// requests of pkg/client against it.
+//
+//go:embed openapi.json
+var spec []byte
+
+// OpenAPI serves the OpenAPI document of the API.
+func OpenAPI(ctx echo.Context) error {
+	return ctx.Blob(http.StatusOK, echo.MIMEApplicationJSONCharsetUTF8, spec)
+}
@@ -0,0 +1,45 @@
+// Package apiv1 implements the versioned REST API served under /api/v1.
+// Unlike the legacy /v2 and /v3 endpoints, which answer 200 with an
+// errorCode for the bundled UI, it answers with the HTTP status of the
+// outcome and reports failures in a consistent error envelope.
+package apiv1
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/middlewares"
+)
+
+// SetRoutes registers the API on g. The group must authenticate requests
+// with the JWT middleware, except for /connect, and should use Errors.
+func SetRoutes(g *echo.Group) {
+	g.POST("/connect", Connect)
+	g.GET("/key", GetKey)
+	g.PUT("/key", PutKey)
+	g.DELETE("/key", DeleteKey)
+	g.GET("/keys", ListKeys)
+	g.GET("/children", ListChildren)
+	g.GET("/search", Search)
+	g.GET("/watch", Watch)
+	g.POST("/txn", Txn)
+	g.POST("/batch", Batch)
+	g.POST("/format", Format)
+	g.GET("/cluster", GetCluster)
+	g.GET("/leases", ListLeases)
+	g.GET("/leases/:id", GetLease)
+	g.DELETE("/leases/:id", RevokeLease)
+	g.POST("/leases/:id/keepalive", KeepAliveLease)
+
+	admin := g.Group("/admin", middlewares.AdminOnly)
+	admin.POST("/members", AddMember)
+	admin.PUT("/members/:id", UpdateMember)
+	admin.DELETE("/members/:id", RemoveMember)
+	admin.POST("/members/:id/promote", PromoteMember)
+	admin.POST("/compact", Compact)
+	admin.POST("/defragment", Defragment)
+	admin.GET("/alarms", ListAlarms)
+	admin.POST("/alarms/disarm", DisarmAlarm)
+	admin.GET("/snapshot", Snapshot)
+	admin.GET("/tokens", ListTokens)
+	admin.POST("/tokens", CreateToken)
+	admin.DELETE("/tokens/:id", RevokeToken)
+}
@@ -0,0 +1,114 @@
+package apiv1
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/trinhdaiphuc/etcdkeeper/config"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/apiv1/types"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/audit"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/etcd"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/middlewares"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/tokens"
+)
+
+func ListTokens(ctx echo.Context) error {
+	list := tokens.Default().List()
+	resp := types.TokensResponse{Tokens: make([]types.Token, 0, len(list))}
+	for _, t := range list {
+		resp.Tokens = append(resp.Tokens, types.Token(t))
+	}
+	return ctx.JSON(http.StatusOK, resp)
+}
+
+// CreateToken creates an API token. The token makes requests as a dedicated
+// etcd user rather than the admin, its credentials are checked against the
+// cluster first. They are only optional when the admin logged in without
+// credentials, to a cluster without authentication.
+func CreateToken(ctx echo.Context) error {
+	var req types.CreateTokenRequest
+	if err := ctx.Bind(&req); err != nil {
+		return err
+	}
+	admin, ok := middlewares.GetUserInfo(ctx)
+	if !ok {
+		return newError(http.StatusUnauthorized, types.CodeUnauthenticated, "missing user info, log in again")
+	}
+	if string(config.GetConfig().SecretKey) == config.DefaultSecretKey {
+		return newError(http.StatusPreconditionFailed, types.CodeFailedPrecondition, "set SECRET_KEY before creating API tokens, the default one protects nothing")
+	}
+	if (req.Username != "" || admin.Username != "") && (req.Username == "" || req.Password == "") {
+		return invalidArgument("username and password of a dedicated etcd user are required")
+	}
+	var ttl time.Duration
+	if req.ExpiresIn != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.ExpiresIn); err != nil || ttl <= 0 {
+			return invalidArgument("expiresIn must be a positive duration such as 720h")
+		}
+	}
+	user := etcd.UserInfo{Host: admin.Host, Username: req.Username, Password: req.Password}
+	if host := strings.TrimSpace(req.Host); host != "" {
+		if !strings.HasPrefix(host, "http") {
+			host = "http://" + host
+		}
+		user.Host = host
+	}
+	cli, err := etcd.GetClientV3(user)
+	if err != nil {
+		return err
+	}
+	cli.Release()
+
+	raw, token, err := tokens.Default().Create(tokens.Options{
+		Name:      req.Name,
+		User:      user,
+		Prefix:    req.Prefix,
+		Access:    req.Access,
+		CreatedBy: admin.Username,
+		TTL:       ttl,
+	})
+	audit.Record(ctx, "token.create", map[string]interface{}{
+		"name": req.Name, "host": user.Host, "username": user.Username,
+		"prefix": req.Prefix, "access": token.Access, "expiresIn": req.ExpiresIn,
+	}, err)
+	if err != nil {
+		return invalidArgument("%v", err)
+	}
+	return ctx.JSON(http.StatusCreated, types.CreateTokenResponse{Token: types.Token(token), Value: raw})
+}
+
+func RevokeToken(ctx echo.Context) error {
+	id := ctx.Param("id")
+	err := tokens.Default().Revoke(id)
+	audit.Record(ctx, "token.revoke", map[string]interface{}{"id": id}, err)
+	if err != nil {
+		return notFound("%v", err)
+	}
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// authorize checks that the API token of the request, if any, allows access
+// to key, or to every key starting with it. Operations that are not limited
+// to a key must pass an empty key, only tokens without a prefix allow them.
+func authorize(ctx echo.Context, key string, write bool) error {
+	token, ok := ctx.Get(middlewares.TokenKey).(*tokens.Token)
+	if !ok || token.Allows(key, write) {
+		return nil
+	}
+	if write && token.Access != tokens.ReadWrite {
+		return newError(http.StatusForbidden, types.CodePermissionDenied, "token %s is read-only", token.Name)
+	}
+	return newError(http.StatusForbidden, types.CodePermissionDenied, "token %s is limited to keys starting with %s", token.Name, token.Prefix)
+}
+
+// scopeKey is the key authorize checks for a subtree of the key tree, the
+// separator alone stands for the whole keyspace.
+func scopeKey(key, separator string) string {
+	if key == separator {
+		return ""
+	}
+	return key
+}
@@ -0,0 +1,135 @@
+package apiv1
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/trinhdaiphuc/etcdkeeper/config"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/apiv1/types"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/etcd"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/formats"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/schemas"
+)
+
+// Txn runs a transaction. Puts in either branch are validated against the
+// value schemas before anything is sent.
+func Txn(ctx echo.Context) error {
+	var req types.TxnRequest
+	if err := ctx.Bind(&req); err != nil {
+		return err
+	}
+	encoding, err := types.ParseEncoding(req.Encoding, types.EncodingAuto)
+	if err != nil {
+		return invalidArgument("%v", err)
+	}
+	for _, c := range req.Compare {
+		if err = authorize(ctx, c.Key, false); err != nil {
+			return err
+		}
+	}
+	for _, op := range append(append([]etcd.TxnOp(nil), req.Success...), req.Failure...) {
+		if err = authorize(ctx, op.Key, op.Type != "range"); err != nil {
+			return err
+		}
+	}
+	cli, err := userClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Release()
+
+	list, err := schemas.ForV3(ctx.Request().Context(), cli.Host)
+	if err != nil {
+		return err
+	}
+	for _, b := range []struct {
+		name string
+		ops  []etcd.TxnOp
+	}{{"success", req.Success}, {"failure", req.Failure}} {
+		for i, err := range schemas.ValidateOps(list, b.ops, encoding, req.ValidateFormat) {
+			var verr *schemas.ValidationError
+			if errors.As(err, &verr) {
+				return err
+			}
+			if err != nil {
+				return invalidArgument("%s op %d: %v", b.name, i, err)
+			}
+		}
+	}
+
+	result, err := etcd.TxnV3(ctx.Request().Context(), cli, req.Txn, encoding)
+	if errors.Is(err, etcd.ErrInvalidTxn) {
+		return invalidArgument("%v", err)
+	}
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(http.StatusOK, result)
+}
+
+// Batch applies a list of puts and deletes with as few transactions as
+// MAX_TXN_OPS allows. It answers 200 with the outcome of every operation
+// even when some of them failed.
+func Batch(ctx echo.Context) error {
+	var req types.BatchRequest
+	if err := ctx.Bind(&req); err != nil {
+		return err
+	}
+	encoding, err := types.ParseEncoding(req.Encoding, types.EncodingAuto)
+	if err != nil {
+		return invalidArgument("%v", err)
+	}
+	cli, err := userClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Release()
+
+	list, err := schemas.ForV3(ctx.Request().Context(), cli.Host)
+	if err != nil {
+		return err
+	}
+	results := make([]etcd.BatchResult, len(req.Ops))
+	for i, err := range schemas.ValidateOps(list, req.Ops, encoding, req.ValidateFormat) {
+		if err != nil {
+			results[i].Error = err.Error()
+		}
+	}
+	for i, op := range req.Ops {
+		if err := authorize(ctx, op.Key, true); err != nil {
+			results[i].Error = err.Error()
+		}
+	}
+
+	etcd.BatchV3(ctx.Request().Context(), cli, req.Ops, results, encoding, config.GetConfig().MaxTxnOps)
+	resp := types.BatchResponse{Results: results}
+	for _, r := range results {
+		if r.OK {
+			resp.Succeeded++
+		} else {
+			resp.Failed++
+		}
+	}
+	return ctx.JSON(http.StatusOK, resp)
+}
+
+// Format validates and pretty-prints a value. The format defaults to the one
+// the key is tagged with.
+func Format(ctx echo.Context) error {
+	var req types.FormatRequest
+	if err := ctx.Bind(&req); err != nil {
+		return err
+	}
+	if req.Format == "" {
+		req.Format = formats.ForKey(req.Key)
+	}
+	if req.Format == "" {
+		return invalidArgument("format is required")
+	}
+	value, err := formats.Format(req.Format, []byte(req.Value), req.Sort)
+	if err != nil {
+		return invalidArgument("%v", err)
+	}
+	return ctx.JSON(http.StatusOK, types.FormatResponse{Format: req.Format, Value: string(value)})
+}
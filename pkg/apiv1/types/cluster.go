@@ -0,0 +1,61 @@
+package types
+
+// MemberStatus is the status of a single cluster member as reported by the
+// member itself.
+type MemberStatus struct {
+	ID               string   `json:"id"`
+	Name             string   `json:"name"`
+	PeerURLs         []string `json:"peerURLs"`
+	ClientURLs       []string `json:"clientURLs"`
+	Endpoint         string   `json:"endpoint"`
+	IsLeader         bool     `json:"isLeader"`
+	IsLearner        bool     `json:"isLearner"`
+	Version          string   `json:"version,omitempty"`
+	RaftTerm         uint64   `json:"raftTerm"`
+	RaftIndex        uint64   `json:"raftIndex"`
+	RaftAppliedIndex uint64   `json:"raftAppliedIndex"`
+	DbSize           int64    `json:"dbSize"`
+	DbSizeInUse      int64    `json:"dbSizeInUse"`
+	// RaftLag is how many entries the member has yet to apply compared to
+	// the leader's raft index.
+	RaftLag uint64 `json:"raftLag"`
+	// Latency is the round trip of the status request in milliseconds.
+	Latency float64  `json:"latency"`
+	Errors  []string `json:"errors,omitempty"`
+	Healthy bool     `json:"healthy"`
+}
+
+// Alarm is an alarm raised on a cluster member.
+type Alarm struct {
+	MemberID   string `json:"memberID"`
+	MemberName string `json:"memberName,omitempty"`
+	Alarm      string `json:"alarm"`
+}
+
+// ClusterStatus is the status of every member of a cluster.
+type ClusterStatus struct {
+	ClusterID string         `json:"clusterID"`
+	Leader    string         `json:"leader"`
+	RaftTerm  uint64         `json:"raftTerm"`
+	Members   []MemberStatus `json:"members"`
+	Alarms    []Alarm        `json:"alarms"`
+}
+
+// Member is a cluster member as returned by the member operations.
+type Member struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	PeerURLs   []string `json:"peerURLs"`
+	ClientURLs []string `json:"clientURLs"`
+	IsLearner  bool     `json:"isLearner"`
+}
+
+// Lease describes a lease and, when requested, the keys attached to it.
+type Lease struct {
+	ID string `json:"id"`
+	// GrantedTTL is the TTL the lease was granted with, in seconds.
+	GrantedTTL int64 `json:"grantedTTL"`
+	// TTL is the remaining TTL in seconds, -1 once the lease has expired.
+	TTL  int64    `json:"ttl"`
+	Keys []string `json:"keys,omitempty"`
+}
@@ -0,0 +1,82 @@
+package types
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Value encodings of the v3 endpoints. Values are bytes in etcd while JSON
+// and form values only carry text, so binary values travel encoded.
+const (
+	// EncodingAuto sends text values as they are and binary values in base64.
+	EncodingAuto   = "auto"
+	EncodingText   = "text"
+	EncodingBase64 = "base64"
+	EncodingHex    = "hex"
+)
+
+// ParseEncoding validates an encoding name, empty names default to fallback.
+func ParseEncoding(name, fallback string) (string, error) {
+	switch name {
+	case "":
+		return fallback, nil
+	case EncodingAuto, EncodingText, EncodingBase64, EncodingHex:
+		return name, nil
+	}
+	return "", fmt.Errorf("unknown encoding %s, expected auto, text, base64 or hex", name)
+}
+
+// IsBinary reports whether value cannot be shown as text: it is not valid
+// UTF-8 or holds control characters other than whitespace, as serialized
+// protobuf messages usually do.
+func IsBinary(value []byte) bool {
+	if !utf8.Valid(value) {
+		return true
+	}
+	for _, b := range value {
+		if b < 0x20 && b != '\t' && b != '\n' && b != '\r' && b != '\f' || b == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// EncodeValue encodes value for a response and returns the encoding that was
+// actually used, which is never EncodingAuto.
+func EncodeValue(value []byte, encoding string) (string, string) {
+	if encoding == EncodingAuto {
+		encoding = EncodingText
+		if IsBinary(value) {
+			encoding = EncodingBase64
+		}
+	}
+	switch encoding {
+	case EncodingBase64:
+		return base64.StdEncoding.EncodeToString(value), encoding
+	case EncodingHex:
+		return hex.EncodeToString(value), encoding
+	}
+	return string(value), EncodingText
+}
+
+// DecodeValue decodes a value received in the given encoding. Auto values
+// are taken as text since they cannot be told apart from it.
+func DecodeValue(value, encoding string) ([]byte, error) {
+	switch encoding {
+	case EncodingBase64:
+		b, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 value: %v", err)
+		}
+		return b, nil
+	case EncodingHex:
+		b, err := hex.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex value: %v", err)
+		}
+		return b, nil
+	}
+	return []byte(value), nil
+}
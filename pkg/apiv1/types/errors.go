@@ -0,0 +1,34 @@
+package types
+
+// Error codes of the error envelope.
+const (
+	CodeInvalidArgument    = "invalid_argument"
+	CodeValidationFailed   = "validation_failed"
+	CodeUnauthenticated    = "unauthenticated"
+	CodePermissionDenied   = "permission_denied"
+	CodeNotFound           = "not_found"
+	CodeAlreadyExists      = "already_exists"
+	CodeFailedPrecondition = "failed_precondition"
+	CodeOutOfRange         = "out_of_range"
+	CodeResourceExhausted  = "resource_exhausted"
+	CodeUnavailable        = "unavailable"
+	CodeDeadlineExceeded   = "deadline_exceeded"
+	CodeInternal           = "internal"
+)
+
+// Error is the body of every failed request: {"error": {...}}.
+type Error struct {
+	Status  int         `json:"-"`
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// ErrorResponse wraps an Error in the envelope.
+type ErrorResponse struct {
+	Error *Error `json:"error"`
+}
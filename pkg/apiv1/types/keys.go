@@ -0,0 +1,44 @@
+package types
+
+// Child is an immediate child of a node of the key tree.
+type Child struct {
+	Key string `json:"key"`
+	Dir bool   `json:"dir"`
+	// HasValue is set when the child is a key of its own, a directory can be
+	// one as well.
+	HasValue bool `json:"hasValue"`
+	// Count is the number of keys below a directory.
+	Count int64 `json:"count"`
+}
+
+// ChildrenPage is a page of the children of a node.
+type ChildrenPage struct {
+	Children []Child `json:"children"`
+	// Next is the key to continue listing from, empty on the last page.
+	Next string `json:"next,omitempty"`
+}
+
+// Snippet is an excerpt of a value around a match. The match spans
+// Text[Start:End].
+type Snippet struct {
+	Text  string `json:"text"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// SearchResult is a matching key with the value snippets that matched.
+type SearchResult struct {
+	Key      string    `json:"key"`
+	Snippets []Snippet `json:"snippets,omitempty"`
+}
+
+// SearchResponse lists the keys that matched a search.
+type SearchResponse struct {
+	Results []SearchResult `json:"results"`
+	// Scanned is the number of keys looked at.
+	Scanned int64 `json:"scanned"`
+	// Truncated is set when the search stopped at the limit.
+	Truncated bool `json:"truncated"`
+	// Revision is the store revision the search ran against.
+	Revision int64 `json:"revision"`
+}
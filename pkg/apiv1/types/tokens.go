@@ -0,0 +1,18 @@
+package types
+
+import "time"
+
+// Token describes an API token. The token itself is only returned once, when
+// it is created.
+type Token struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Host      string    `json:"host"`
+	Username  string    `json:"username,omitempty"`
+	Prefix    string    `json:"prefix"`
+	Access    string    `json:"access"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	// ExpiresAt is nil for tokens that do not expire.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
@@ -0,0 +1,83 @@
+package types
+
+// Compare is a condition of a transaction. Target selects what is compared,
+// value, version, createRevision, modRevision or lease, against the field of
+// the same name using Result, one of =, !=, < or >.
+type Compare struct {
+	Key            string `json:"key"`
+	Target         string `json:"target"`
+	Result         string `json:"result"`
+	Value          string `json:"value,omitempty"`
+	Version        int64  `json:"version,omitempty"`
+	CreateRevision int64  `json:"createRevision,omitempty"`
+	ModRevision    int64  `json:"modRevision,omitempty"`
+	Lease          string `json:"lease,omitempty"`
+}
+
+// TxnOp is an operation of a transaction: a put, a delete or a range.
+type TxnOp struct {
+	Type  string `json:"type"`
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+	// Prefix extends a delete or a range to every key starting with Key.
+	Prefix bool `json:"prefix,omitempty"`
+	// Lease attaches a put to a lease and Detach removes the key from its
+	// lease. Without either a put keeps the lease the key has, IgnoreLease
+	// asks for that explicitly.
+	Lease       string `json:"lease,omitempty"`
+	Detach      bool   `json:"detach,omitempty"`
+	IgnoreLease bool   `json:"ignoreLease,omitempty"`
+	// PrevKV returns the previous key-values of a put or a delete.
+	PrevKV bool `json:"prevKV,omitempty"`
+	// Limit and KeysOnly apply to ranges.
+	Limit    int64 `json:"limit,omitempty"`
+	KeysOnly bool  `json:"keysOnly,omitempty"`
+}
+
+// Txn is a transaction: Success runs when every compare holds, Failure
+// otherwise.
+type Txn struct {
+	Compare []Compare `json:"compare"`
+	Success []TxnOp   `json:"success"`
+	Failure []TxnOp   `json:"failure"`
+}
+
+// TxnKeyValue is a key-value returned by a transaction.
+type TxnKeyValue struct {
+	Key            string `json:"key"`
+	Value          string `json:"value,omitempty"`
+	Encoding       string `json:"encoding,omitempty"`
+	CreateRevision int64  `json:"createRevision"`
+	ModRevision    int64  `json:"modRevision"`
+	Version        int64  `json:"version"`
+	Lease          string `json:"lease,omitempty"`
+}
+
+// TxnOpResult is the result of a single operation.
+type TxnOpResult struct {
+	Type    string        `json:"type"`
+	Key     string        `json:"key"`
+	Deleted int64         `json:"deleted,omitempty"`
+	Count   int64         `json:"count,omitempty"`
+	More    bool          `json:"more,omitempty"`
+	Kvs     []TxnKeyValue `json:"kvs,omitempty"`
+	PrevKvs []TxnKeyValue `json:"prevKvs,omitempty"`
+}
+
+// TxnResult tells which branch ran and the result of each of its operations.
+type TxnResult struct {
+	Succeeded bool          `json:"succeeded"`
+	Revision  int64         `json:"revision"`
+	Results   []TxnOpResult `json:"results"`
+}
+
+// BatchResult is the outcome of a single operation of a batch.
+type BatchResult struct {
+	Type    string `json:"type"`
+	Key     string `json:"key"`
+	OK      bool   `json:"ok"`
+	Deleted int64  `json:"deleted,omitempty"`
+	// Revision is the revision of the transaction that applied the operation.
+	Revision int64  `json:"revision,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
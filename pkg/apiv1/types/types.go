@@ -0,0 +1,269 @@
+// Package types holds the requests and responses of the etcdkeeper REST API,
+// see /openapi.json. It only depends on the standard library so that API
+// clients can import it without the server.
+package types
+
+// ConnectRequest logs in to an etcd cluster.
+type ConnectRequest struct {
+	Host     string `json:"host"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// ConnectResponse carries the token to send as a bearer token.
+type ConnectResponse struct {
+	Token string            `json:"token"`
+	Info  map[string]string `json:"info"`
+}
+
+// KeyValue is a key with its value and metadata.
+type KeyValue struct {
+	Key string `json:"key"`
+	// Value is encoded as told by Encoding, see the encoding parameter.
+	Value          string `json:"value"`
+	Encoding       string `json:"encoding"`
+	Binary         bool   `json:"binary"`
+	CreateRevision int64  `json:"createRevision"`
+	ModRevision    int64  `json:"modRevision"`
+	Version        int64  `json:"version"`
+	Lease          string `json:"lease,omitempty"`
+	// TTL is the remaining TTL of the lease in seconds.
+	TTL int64 `json:"ttl,omitempty"`
+	// Message, JSON and JSONError are set for keys mapped to a protobuf
+	// message type.
+	Message   string `json:"message,omitempty"`
+	JSON      string `json:"json,omitempty"`
+	JSONError string `json:"jsonError,omitempty"`
+}
+
+// GetKeyRequest reads a single key.
+type GetKeyRequest struct {
+	Key      string `query:"key"`
+	Encoding string `query:"encoding"`
+}
+
+// ListKeysRequest reads the keys starting with Prefix. After pages through
+// the keys: pass the last key of a page that has more, along with the
+// Revision of the first page so that every page shows the same state.
+type ListKeysRequest struct {
+	Prefix   string `query:"prefix"`
+	After    string `query:"after"`
+	Limit    int64  `query:"limit"`
+	KeysOnly bool   `query:"keysOnly"`
+	Encoding string `query:"encoding"`
+	// Revision reads the keys as of a past revision, the latest when zero.
+	Revision int64 `query:"revision"`
+}
+
+// ListKeysResponse lists keys in key order.
+type ListKeysResponse struct {
+	Kvs   []KeyValue `json:"kvs"`
+	Count int64      `json:"count"`
+	More  bool       `json:"more"`
+	// Revision is the revision the keys were read at.
+	Revision int64 `json:"revision"`
+}
+
+// PutKeyRequest writes a key. The lease fields behave like on the legacy put:
+// TTL grants a new lease, Lease attaches to an existing one, Detach removes
+// the key from its lease and by default the key keeps its lease. Setting more
+// than one of them is an invalid argument.
+type PutKeyRequest struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Encoding string `json:"encoding"`
+	TTL      int64  `json:"ttl"`
+	Lease    string `json:"lease"`
+	Detach   bool   `json:"detach"`
+	// ProtoJSON encodes Value, the JSON rendering of the protobuf message
+	// mapped to Key.
+	ProtoJSON bool `json:"protoJSON"`
+	// ValidateFormat rejects a Value that does not parse in the format of
+	// Key.
+	ValidateFormat bool `json:"validateFormat"`
+}
+
+// WatchRequest watches a key, or every key starting with it, from Revision
+// or from now when it is zero.
+type WatchRequest struct {
+	Key      string `query:"key"`
+	Prefix   bool   `query:"prefix"`
+	Revision int64  `query:"revision"`
+	PrevKV   bool   `query:"prevKV"`
+	Encoding string `query:"encoding"`
+}
+
+// WatchEvent is a change sent by the watch stream.
+type WatchEvent struct {
+	// Type is put or delete.
+	Type     string    `json:"type"`
+	Kv       KeyValue  `json:"kv"`
+	PrevKv   *KeyValue `json:"prevKv,omitempty"`
+	Revision int64     `json:"revision"`
+}
+
+// DeleteKeyRequest deletes a key, or every key starting with it.
+type DeleteKeyRequest struct {
+	Key    string `query:"key"`
+	Prefix bool   `query:"prefix"`
+}
+
+// DeleteKeyResponse tells how many keys were deleted.
+type DeleteKeyResponse struct {
+	Deleted  int64 `json:"deleted"`
+	Revision int64 `json:"revision"`
+}
+
+// ChildrenRequest lists the immediate children of a key of the tree.
+type ChildrenRequest struct {
+	Key   string `query:"key"`
+	After string `query:"after"`
+	Limit int    `query:"limit"`
+}
+
+// SearchRequest searches the keys under Key the user may read, see the
+// legacy search endpoint.
+type SearchRequest struct {
+	Key        string `query:"key"`
+	Pattern    string `query:"pattern"`
+	Mode       string `query:"mode"`
+	Value      string `query:"value"`
+	ValueMode  string `query:"valueMode"`
+	IgnoreCase bool   `query:"ignoreCase"`
+	Limit      int    `query:"limit"`
+}
+
+// TxnRequest is a transaction with the encoding of its values.
+type TxnRequest struct {
+	Txn
+	Encoding string `json:"encoding"`
+	// ValidateFormat rejects puts whose value does not parse in the format
+	// of their key.
+	ValidateFormat bool `json:"validateFormat"`
+}
+
+// BatchRequest is a list of puts and deletes.
+type BatchRequest struct {
+	Ops            []TxnOp `json:"ops"`
+	Encoding       string  `json:"encoding"`
+	ValidateFormat bool    `json:"validateFormat"`
+}
+
+// BatchResponse reports every operation of a batch.
+type BatchResponse struct {
+	Results   []BatchResult `json:"results"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+}
+
+// FormatRequest validates and pretty-prints Value.
+type FormatRequest struct {
+	Format string `json:"format"`
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Sort   bool   `json:"sort"`
+}
+
+// FormatResponse is the formatted value.
+type FormatResponse struct {
+	Format string `json:"format"`
+	Value  string `json:"value"`
+}
+
+// LeasesResponse lists leases.
+type LeasesResponse struct {
+	Leases []Lease `json:"leases"`
+}
+
+// KeepAliveResponse is the TTL of a lease after a keep-alive.
+type KeepAliveResponse struct {
+	ID  string `json:"id"`
+	TTL int64  `json:"ttl"`
+}
+
+// AddMemberRequest adds a member, Confirm must be the first peer URL.
+type AddMemberRequest struct {
+	PeerURLs []string `json:"peerURLs"`
+	Learner  bool     `json:"learner"`
+	Confirm  string   `json:"confirm"`
+}
+
+// AddMemberResponse is the new member and the resulting member list.
+type AddMemberResponse struct {
+	Member  Member   `json:"member"`
+	Members []Member `json:"members"`
+}
+
+// MemberRequest confirms an operation on the member of the path by
+// repeating its ID in Confirm.
+type MemberRequest struct {
+	PeerURLs []string `json:"peerURLs"`
+	Confirm  string   `json:"confirm" query:"confirm"`
+}
+
+// MembersResponse is the member list after a member operation.
+type MembersResponse struct {
+	Members []Member `json:"members"`
+}
+
+// CompactRequest compacts the history up to Revision, which Confirm repeats.
+type CompactRequest struct {
+	Revision int64  `json:"revision"`
+	Physical bool   `json:"physical"`
+	Confirm  string `json:"confirm"`
+}
+
+// CompactResponse is the compacted and the current revision.
+type CompactResponse struct {
+	Revision        int64 `json:"revision"`
+	CurrentRevision int64 `json:"currentRevision"`
+}
+
+// DefragmentRequest defragments member ID, which Confirm repeats.
+type DefragmentRequest struct {
+	ID      string `json:"id"`
+	Confirm string `json:"confirm"`
+}
+
+// AlarmsResponse lists alarms.
+type AlarmsResponse struct {
+	Alarms []Alarm `json:"alarms"`
+}
+
+// DisarmRequest disarms an alarm of a member. Leaving both empty disarms
+// every alarm and must be confirmed with "all", otherwise Confirm is the
+// alarm name.
+type DisarmRequest struct {
+	ID      string `json:"id"`
+	Alarm   string `json:"alarm"`
+	Confirm string `json:"confirm"`
+}
+
+// TokensResponse lists API tokens.
+type TokensResponse struct {
+	Tokens []Token `json:"tokens"`
+}
+
+// CreateTokenRequest creates an API token for automation. Requests made with
+// the token use the cluster of the admin creating it unless Host is set, and
+// the etcd user of Username and Password, which are required unless the
+// cluster runs without authentication.
+type CreateTokenRequest struct {
+	Name string `json:"name"`
+	// Prefix limits the token to the keys starting with it.
+	Prefix string `json:"prefix"`
+	// Access is read, the default, or readwrite.
+	Access string `json:"access"`
+	// ExpiresIn is a duration such as 720h, the token does not expire when
+	// empty.
+	ExpiresIn string `json:"expiresIn"`
+	Host      string `json:"host"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+}
+
+// CreateTokenResponse is the new token. Value is only returned here.
+type CreateTokenResponse struct {
+	Token
+	Value string `json:"token"`
+}
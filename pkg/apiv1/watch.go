@@ -0,0 +1,132 @@
+package apiv1
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/apiv1/types"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// watchKeepAlive is how often an idle watch stream sends a comment, keeping
+// proxies from closing it.
+const watchKeepAlive = 15 * time.Second
+
+var watchStreams = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "etcdkeeper_watch_streams",
+	Help: "Open watch streams of the API.",
+})
+
+// Watch streams the changes to a key, or to every key starting with it, as
+// server-sent events until the client goes away. Each event is named after
+// its type and carries a types.WatchEvent, its id is the revision. A watch that
+// fails once the stream started, e.g. because the revision was compacted,
+// ends with an error event carrying the error envelope.
+func Watch(ctx echo.Context) error {
+	var req types.WatchRequest
+	if err := ctx.Bind(&req); err != nil {
+		return err
+	}
+	if req.Key == "" && !req.Prefix {
+		return invalidArgument("key is required")
+	}
+	if req.Revision < 0 {
+		return invalidArgument("revision must not be negative")
+	}
+	if err := authorize(ctx, req.Key, false); err != nil {
+		return err
+	}
+	encoding, err := types.ParseEncoding(req.Encoding, types.EncodingAuto)
+	if err != nil {
+		return invalidArgument("%v", err)
+	}
+	cli, err := userClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer cli.Release()
+
+	var opts []clientv3.OpOption
+	if req.Prefix {
+		opts = append(opts, clientv3.WithPrefix())
+	}
+	if req.Revision > 0 {
+		opts = append(opts, clientv3.WithRev(req.Revision))
+	}
+	if req.PrevKV {
+		opts = append(opts, clientv3.WithPrevKV())
+	}
+	reqCtx := ctx.Request().Context()
+	wch := cli.Watch(clientv3.WithRequireLeader(reqCtx), req.Key, opts...)
+
+	res := ctx.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+	watchStreams.Inc()
+	defer watchStreams.Dec()
+
+	ticker := time.NewTicker(watchKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-reqCtx.Done():
+			return nil
+		case <-ticker.C:
+			if _, err = fmt.Fprint(res, ": keepalive\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		case resp, ok := <-wch:
+			if !ok {
+				return nil
+			}
+			if err = resp.Err(); err != nil {
+				writeEvent(res, "error", 0, types.ErrorResponse{Error: fromError(err)})
+				return nil
+			}
+			for _, ev := range resp.Events {
+				event := types.WatchEvent{
+					Type:     strings.ToLower(ev.Type.String()),
+					Kv:       newKeyValue(ev.Kv, encoding),
+					Revision: ev.Kv.ModRevision,
+				}
+				if ev.PrevKv != nil {
+					prev := newKeyValue(ev.PrevKv, encoding)
+					event.PrevKv = &prev
+				}
+				if err = writeEvent(res, event.Type, event.Revision, event); err != nil {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// writeEvent writes a server-sent event and flushes it, id is left out when
+// zero.
+func writeEvent(res *echo.Response, name string, id int64, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "event: %s\n", name)
+	if id != 0 {
+		fmt.Fprintf(&b, "id: %d\n", id)
+	}
+	fmt.Fprintf(&b, "data: %s\n\n", payload)
+	if _, err = res.Write([]byte(b.String())); err != nil {
+		return err
+	}
+	res.Flush()
+	return nil
+}
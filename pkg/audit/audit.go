@@ -0,0 +1,77 @@
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/trinhdaiphuc/etcdkeeper/config"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/middlewares"
+	"go.uber.org/zap"
+)
+
+// Entry is a single line of the audit log.
+type Entry struct {
+	Time      time.Time              `json:"time"`
+	User      string                 `json:"user"`
+	Cluster   string                 `json:"cluster"`
+	RemoteIP  string                 `json:"remoteIP"`
+	RequestID string                 `json:"requestID,omitempty"`
+	Action    string                 `json:"action"`
+	Params    map[string]interface{} `json:"params,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+}
+
+var (
+	once   sync.Once
+	mu     sync.Mutex
+	writer io.Writer
+)
+
+func open() {
+	writer = os.Stdout
+	path := config.GetConfig().AuditLogFile
+	if path == "" {
+		return
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		zap.L().Error("audit: open log file, writing to stdout", zap.String("file", path), zap.Error(err))
+		return
+	}
+	writer = f
+}
+
+// Record writes an audit entry for an operation performed by the user of
+// the request. Params must never contain values or credentials.
+func Record(ctx echo.Context, action string, params map[string]interface{}, err error) {
+	once.Do(open)
+	entry := Entry{
+		Time:      time.Now().UTC(),
+		RemoteIP:  ctx.RealIP(),
+		RequestID: ctx.Response().Header().Get(echo.HeaderXRequestID),
+		Action:    action,
+		Params:    params,
+	}
+	if user, ok := middlewares.GetUserInfo(ctx); ok {
+		entry.User = user.Username
+		entry.Cluster = user.Host
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	line, mErr := json.Marshal(entry)
+	if mErr != nil {
+		zap.L().Error("audit: encode entry", zap.Error(mErr))
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, wErr := writer.Write(append(line, '\n')); wErr != nil {
+		zap.L().Error("audit: write entry", zap.Error(wErr))
+	}
+}
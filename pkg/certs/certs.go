@@ -0,0 +1,88 @@
+// Package certs holds the HTTPS certificate of the server and the CAs of
+// the client certificates it accepts. Both can be loaded again while the
+// server runs, new connections use them right away.
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/trinhdaiphuc/etcdkeeper/config"
+)
+
+// Server is the TLS state of the HTTPS server.
+type Server struct {
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	min       uint16
+}
+
+// Load reads the certificate, the key and the optional client CA bundle set
+// in cfg.
+func Load(cfg *config.AppConfig) (*Server, error) {
+	s := &Server{}
+	if err := s.Reload(cfg); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload reads the files of cfg again. On error the server keeps the
+// certificates it had.
+func (s *Server) Reload(cfg *config.AppConfig) error {
+	cert, err := tls.LoadX509KeyPair(cfg.ServerCertFile, cfg.ServerKeyFile)
+	if err != nil {
+		return fmt.Errorf("server certificate: %v", err)
+	}
+	var pool *x509.CertPool
+	if cfg.ServerClientCaFile != "" {
+		data, err := ioutil.ReadFile(cfg.ServerClientCaFile)
+		if err != nil {
+			return fmt.Errorf("client CA: %v", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("client CA: no certificate found in %s", cfg.ServerClientCaFile)
+		}
+	}
+	min := uint16(tls.VersionTLS12)
+	if cfg.ServerTLSMinVersion == "1.3" {
+		min = tls.VersionTLS13
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cert, s.clientCAs, s.min = &cert, pool, min
+	return nil
+}
+
+// TLSConfig returns the configuration of the HTTPS listener, offering HTTP/2
+// and HTTP/1.1. Every handshake uses the certificates loaded last and the
+// NextProtos of the returned configuration.
+func (s *Server) TLSConfig() *tls.Config {
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		c := &tls.Config{
+			Certificates: []tls.Certificate{*s.cert},
+			MinVersion:   s.min,
+			NextProtos:   base.NextProtos,
+		}
+		if s.clientCAs != nil {
+			c.ClientCAs = s.clientCAs
+			// Requests without a certificate are rejected by
+			// middlewares.ClientCert, except for the probes.
+			c.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+		return c, nil
+	}
+	return base
+}
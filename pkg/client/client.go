@@ -0,0 +1,445 @@
+// Package client calls the etcdkeeper REST API, see pkg/apiv1/types and
+// /openapi.json. Going through etcdkeeper instead of etcd keeps the audit
+// log, the schema and format checks and the auth mapping of the server.
+//
+//	c := client.New("http://localhost:8080")
+//	if _, err := c.Connect(ctx, types.ConnectRequest{Host: "127.0.0.1:2379"}); err != nil {
+//		return err
+//	}
+//	kv, err := c.GetKey(ctx, "/config/app", "")
+//
+// Failed requests return a *types.Error carrying the HTTP status.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/apiv1/types"
+)
+
+// Client is an etcdkeeper API client. It is safe for concurrent use once
+// connected.
+type Client struct {
+	baseURL string
+	http    *http.Client
+	token   string
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests, http.DefaultClient
+// by default.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.http = hc
+	}
+}
+
+// WithToken sets the token sent as bearer token, such as an API token, for
+// clients that do not call Connect.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// New returns a client for the etcdkeeper server at baseURL, such as
+// http://localhost:8080.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/") + "/api/v1",
+		http:    http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Token returns the token the client authenticates with.
+func (c *Client) Token() string {
+	return c.token
+}
+
+// Connect logs in to an etcd cluster and keeps the token for the next
+// requests.
+func (c *Client) Connect(ctx context.Context, req types.ConnectRequest) (*types.ConnectResponse, error) {
+	var resp types.ConnectResponse
+	if err := c.do(ctx, http.MethodPost, "/connect", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	c.token = resp.Token
+	return &resp, nil
+}
+
+// GetKey reads a key, encoding is one of the types.Encoding values and
+// defaults to auto.
+func (c *Client) GetKey(ctx context.Context, key, encoding string) (*types.KeyValue, error) {
+	query := url.Values{"key": {key}}
+	setString(query, "encoding", encoding)
+	var kv types.KeyValue
+	if err := c.do(ctx, http.MethodGet, "/key", query, nil, &kv); err != nil {
+		return nil, err
+	}
+	return &kv, nil
+}
+
+func (c *Client) ListKeys(ctx context.Context, req types.ListKeysRequest) (*types.ListKeysResponse, error) {
+	query := url.Values{"prefix": {req.Prefix}}
+	setString(query, "after", req.After)
+	if req.Limit > 0 {
+		query.Set("limit", strconv.FormatInt(req.Limit, 10))
+	}
+	setBool(query, "keysOnly", req.KeysOnly)
+	setString(query, "encoding", req.Encoding)
+	if req.Revision > 0 {
+		query.Set("revision", strconv.FormatInt(req.Revision, 10))
+	}
+	var resp types.ListKeysResponse
+	if err := c.do(ctx, http.MethodGet, "/keys", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// PutKey writes a key and returns it as stored.
+func (c *Client) PutKey(ctx context.Context, req types.PutKeyRequest) (*types.KeyValue, error) {
+	var kv types.KeyValue
+	if err := c.do(ctx, http.MethodPut, "/key", nil, req, &kv); err != nil {
+		return nil, err
+	}
+	return &kv, nil
+}
+
+// DeleteKey deletes a key, or every key starting with it when prefix is set.
+func (c *Client) DeleteKey(ctx context.Context, key string, prefix bool) (*types.DeleteKeyResponse, error) {
+	query := url.Values{"key": {key}}
+	setBool(query, "prefix", prefix)
+	var resp types.DeleteKeyResponse
+	if err := c.do(ctx, http.MethodDelete, "/key", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Watch streams the changes to a key, or to every key starting with it, to fn
+// until ctx is done, the server ends the stream or fn returns an error,
+// which Watch then returns.
+func (c *Client) Watch(ctx context.Context, req types.WatchRequest, fn func(types.WatchEvent) error) error {
+	query := url.Values{"key": {req.Key}}
+	setBool(query, "prefix", req.Prefix)
+	if req.Revision > 0 {
+		query.Set("revision", strconv.FormatInt(req.Revision, 10))
+	}
+	setBool(query, "prevKV", req.PrevKV)
+	setString(query, "encoding", req.Encoding)
+	resp, err := c.send(ctx, http.MethodGet, "/watch", query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var name, data string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data += strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		case line == "" && data != "":
+			if name == "error" {
+				var env types.ErrorResponse
+				if err = json.Unmarshal([]byte(data), &env); err != nil || env.Error == nil {
+					return fmt.Errorf("watch failed: %s", data)
+				}
+				return env.Error
+			}
+			var event types.WatchEvent
+			if err = json.Unmarshal([]byte(data), &event); err != nil {
+				return err
+			}
+			if err = fn(event); err != nil {
+				return err
+			}
+			name, data = "", ""
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return scanner.Err()
+}
+
+func (c *Client) ListChildren(ctx context.Context, req types.ChildrenRequest) (*types.ChildrenPage, error) {
+	query := url.Values{}
+	setString(query, "key", req.Key)
+	setString(query, "after", req.After)
+	setInt(query, "limit", req.Limit)
+	var page types.ChildrenPage
+	if err := c.do(ctx, http.MethodGet, "/children", query, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+func (c *Client) Search(ctx context.Context, req types.SearchRequest) (*types.SearchResponse, error) {
+	query := url.Values{}
+	setString(query, "key", req.Key)
+	setString(query, "pattern", req.Pattern)
+	setString(query, "mode", req.Mode)
+	setString(query, "value", req.Value)
+	setString(query, "valueMode", req.ValueMode)
+	setBool(query, "ignoreCase", req.IgnoreCase)
+	setInt(query, "limit", req.Limit)
+	var resp types.SearchResponse
+	if err := c.do(ctx, http.MethodGet, "/search", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) Txn(ctx context.Context, req types.TxnRequest) (*types.TxnResult, error) {
+	var resp types.TxnResult
+	if err := c.do(ctx, http.MethodPost, "/txn", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Batch applies puts and deletes. It only fails when the request as a whole
+// does, check the results for the operations that failed.
+func (c *Client) Batch(ctx context.Context, req types.BatchRequest) (*types.BatchResponse, error) {
+	var resp types.BatchResponse
+	if err := c.do(ctx, http.MethodPost, "/batch", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) Format(ctx context.Context, req types.FormatRequest) (*types.FormatResponse, error) {
+	var resp types.FormatResponse
+	if err := c.do(ctx, http.MethodPost, "/format", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) Cluster(ctx context.Context) (*types.ClusterStatus, error) {
+	var status types.ClusterStatus
+	if err := c.do(ctx, http.MethodGet, "/cluster", nil, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+func (c *Client) ListLeases(ctx context.Context, withKeys bool) ([]types.Lease, error) {
+	query := url.Values{}
+	setBool(query, "keys", withKeys)
+	var resp types.LeasesResponse
+	if err := c.do(ctx, http.MethodGet, "/leases", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Leases, nil
+}
+
+func (c *Client) GetLease(ctx context.Context, id string) (*types.Lease, error) {
+	var lease types.Lease
+	if err := c.do(ctx, http.MethodGet, "/leases/"+url.PathEscape(id), nil, nil, &lease); err != nil {
+		return nil, err
+	}
+	return &lease, nil
+}
+
+func (c *Client) RevokeLease(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/leases/"+url.PathEscape(id), nil, nil, nil)
+}
+
+func (c *Client) KeepAliveLease(ctx context.Context, id string) (*types.KeepAliveResponse, error) {
+	var resp types.KeepAliveResponse
+	if err := c.do(ctx, http.MethodPost, "/leases/"+url.PathEscape(id)+"/keepalive", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) AddMember(ctx context.Context, req types.AddMemberRequest) (*types.AddMemberResponse, error) {
+	var resp types.AddMemberResponse
+	if err := c.do(ctx, http.MethodPost, "/admin/members", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) UpdateMember(ctx context.Context, id string, req types.MemberRequest) ([]types.Member, error) {
+	return c.members(ctx, http.MethodPut, "/admin/members/"+url.PathEscape(id), nil, req)
+}
+
+// RemoveMember removes member id, confirm must repeat it.
+func (c *Client) RemoveMember(ctx context.Context, id, confirm string) ([]types.Member, error) {
+	return c.members(ctx, http.MethodDelete, "/admin/members/"+url.PathEscape(id), url.Values{"confirm": {confirm}}, nil)
+}
+
+// PromoteMember promotes learner id, confirm must repeat it.
+func (c *Client) PromoteMember(ctx context.Context, id, confirm string) ([]types.Member, error) {
+	return c.members(ctx, http.MethodPost, "/admin/members/"+url.PathEscape(id)+"/promote", nil, types.MemberRequest{Confirm: confirm})
+}
+
+func (c *Client) members(ctx context.Context, method, path string, query url.Values, body interface{}) ([]types.Member, error) {
+	var resp types.MembersResponse
+	if err := c.do(ctx, method, path, query, body, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Members, nil
+}
+
+func (c *Client) Compact(ctx context.Context, req types.CompactRequest) (*types.CompactResponse, error) {
+	var resp types.CompactResponse
+	if err := c.do(ctx, http.MethodPost, "/admin/compact", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) Defragment(ctx context.Context, req types.DefragmentRequest) (*types.MemberStatus, error) {
+	var status types.MemberStatus
+	if err := c.do(ctx, http.MethodPost, "/admin/defragment", nil, req, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+func (c *Client) ListAlarms(ctx context.Context) ([]types.Alarm, error) {
+	var resp types.AlarmsResponse
+	if err := c.do(ctx, http.MethodGet, "/admin/alarms", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Alarms, nil
+}
+
+// DisarmAlarm disarms alarms and returns the ones it disarmed.
+func (c *Client) DisarmAlarm(ctx context.Context, req types.DisarmRequest) ([]types.Alarm, error) {
+	var resp types.AlarmsResponse
+	if err := c.do(ctx, http.MethodPost, "/admin/alarms/disarm", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Alarms, nil
+}
+
+func (c *Client) ListTokens(ctx context.Context) ([]types.Token, error) {
+	var resp types.TokensResponse
+	if err := c.do(ctx, http.MethodGet, "/admin/tokens", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Tokens, nil
+}
+
+// CreateToken creates an API token, its value is only returned here.
+func (c *Client) CreateToken(ctx context.Context, req types.CreateTokenRequest) (*types.CreateTokenResponse, error) {
+	var resp types.CreateTokenResponse
+	if err := c.do(ctx, http.MethodPost, "/admin/tokens", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) RevokeToken(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/admin/tokens/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// Snapshot downloads a snapshot of the backend database, the caller must
+// close it.
+func (c *Client) Snapshot(ctx context.Context) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, http.MethodGet, "/admin/snapshot", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// do sends a request with body encoded as JSON and decodes the response into
+// out, unless out is nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	resp, err := c.send(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// send sends a request and turns error statuses into an *types.Error.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	var env types.ErrorResponse
+	if json.Unmarshal(data, &env) != nil || env.Error == nil {
+		env.Error = &types.Error{Code: types.CodeInternal, Message: fmt.Sprintf("%s: %s", resp.Status, bytes.TrimSpace(data))}
+	}
+	env.Error.Status = resp.StatusCode
+	return nil, env.Error
+}
+
+func setString(query url.Values, name, value string) {
+	if value != "" {
+		query.Set(name, value)
+	}
+}
+
+func setBool(query url.Values, name string, value bool) {
+	if value {
+		query.Set(name, "true")
+	}
+}
+
+func setInt(query url.Values, name string, value int) {
+	if value > 0 {
+		query.Set(name, strconv.Itoa(value))
+	}
+}
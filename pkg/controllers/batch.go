@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/trinhdaiphuc/etcdkeeper/config"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/apiv1/types"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/etcd"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/schemas"
+)
+
+type batchRequest struct {
+	Ops      []etcd.TxnOp `json:"ops"`
+	Encoding string       `json:"encoding"`
+	// ValidateFormat rejects puts whose value does not parse in the format
+	// of their key, as on PutV3.
+	ValidateFormat bool `json:"validateFormat"`
+}
+
+// BatchV3 applies a list of puts and deletes with as few transactions as
+// MAX_TXN_OPS allows and reports the outcome of every operation. Puts that
+// fail validation are reported without being sent.
+func BatchV3(ctx echo.Context) error {
+	var req batchRequest
+	if err := ctx.Bind(&req); err != nil {
+		return errorJSON(ctx, http.StatusBadRequest, err.Error())
+	}
+	encoding, err := types.ParseEncoding(req.Encoding, types.EncodingAuto)
+	if err != nil {
+		return errorJSON(ctx, http.StatusBadRequest, err.Error())
+	}
+
+	cli, err := userClientV3(ctx)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	defer cli.Release()
+
+	list, err := schemas.ForV3(ctx.Request().Context(), cli.Host)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	results := make([]etcd.BatchResult, len(req.Ops))
+	for i, err := range schemas.ValidateOps(list, req.Ops, encoding, req.ValidateFormat) {
+		if err != nil {
+			results[i].Error = err.Error()
+		}
+	}
+
+	etcd.BatchV3(ctx.Request().Context(), cli, req.Ops, results, encoding, config.GetConfig().MaxTxnOps)
+	failed := 0
+	for _, r := range results {
+		if !r.OK {
+			failed++
+		}
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"results":   results,
+		"succeeded": len(results) - failed,
+		"failed":    failed,
+	})
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/audit"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/etcd"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/middlewares"
+)
+
+func GetClusterV3(ctx echo.Context) error {
+	userInfo, ok := middlewares.GetUserInfo(ctx)
+	if !ok {
+		return ctx.String(http.StatusOK, "Missing User's info. Login again")
+	}
+
+	cli, err := etcd.GetClientV3(*userInfo)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	defer cli.Release()
+
+	status, err := etcd.GetClusterStatusV3(ctx.Request().Context(), cli)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	return ctx.JSON(http.StatusOK, status)
+}
+
+func AddMemberV3(ctx echo.Context) error {
+	peerURLs := splitList(ctx.FormValue("peerURLs"))
+	learner, _ := strconv.ParseBool(ctx.FormValue("learner"))
+	if len(peerURLs) == 0 {
+		return errorJSON(ctx, http.StatusBadRequest, "peerURLs is required")
+	}
+	if !confirmed(ctx, peerURLs[0]) {
+		return errorJSON(ctx, http.StatusBadRequest, "confirm must be set to the first peer URL of the new member")
+	}
+
+	cli, err := userClientV3(ctx)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	defer cli.Release()
+
+	member, members, err := etcd.AddMemberV3(ctx.Request().Context(), cli, peerURLs, learner)
+	audit.Record(ctx, "member.add", map[string]interface{}{"peerURLs": peerURLs, "learner": learner}, err)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"member": member, "members": members})
+}
+
+func RemoveMemberV3(ctx echo.Context) error {
+	return memberOpV3(ctx, "member.remove", func(cli *etcd.ClientV3, id uint64) ([]etcd.Member, error) {
+		return etcd.RemoveMemberV3(ctx.Request().Context(), cli, id)
+	})
+}
+
+func UpdateMemberV3(ctx echo.Context) error {
+	peerURLs := splitList(ctx.FormValue("peerURLs"))
+	if len(peerURLs) == 0 {
+		return errorJSON(ctx, http.StatusBadRequest, "peerURLs is required")
+	}
+	return memberOpV3(ctx, "member.update", func(cli *etcd.ClientV3, id uint64) ([]etcd.Member, error) {
+		return etcd.UpdateMemberV3(ctx.Request().Context(), cli, id, peerURLs)
+	})
+}
+
+func PromoteMemberV3(ctx echo.Context) error {
+	return memberOpV3(ctx, "member.promote", func(cli *etcd.ClientV3, id uint64) ([]etcd.Member, error) {
+		return etcd.PromoteMemberV3(ctx.Request().Context(), cli, id)
+	})
+}
+
+// memberOpV3 runs an operation on an existing member once the request has
+// confirmed it by echoing the member ID.
+func memberOpV3(ctx echo.Context, action string, op func(cli *etcd.ClientV3, id uint64) ([]etcd.Member, error)) error {
+	memberID := ctx.FormValue("id")
+	id, err := etcd.ParseID(memberID)
+	if err != nil {
+		return errorJSON(ctx, http.StatusBadRequest, "invalid member id "+memberID)
+	}
+	if !confirmed(ctx, memberID) {
+		return errorJSON(ctx, http.StatusBadRequest, "confirm must be set to the member id")
+	}
+
+	cli, err := userClientV3(ctx)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	defer cli.Release()
+
+	members, err := op(cli, id)
+	params := map[string]interface{}{"id": etcd.FormatID(id)}
+	if peerURLs := ctx.FormValue("peerURLs"); peerURLs != "" {
+		params["peerURLs"] = splitList(peerURLs)
+	}
+	audit.Record(ctx, action, params, err)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"members": members})
+}
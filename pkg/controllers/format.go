@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/formats"
+)
+
+// Format validates and pretty-prints a value. The format defaults to the
+// one the key is tagged with.
+func Format(ctx echo.Context) error {
+	format := ctx.FormValue("format")
+	if format == "" {
+		format = formats.ForKey(ctx.FormValue("key"))
+	}
+	if format == "" {
+		return errorJSON(ctx, http.StatusBadRequest, "format is required")
+	}
+	sortKeys, _ := strconv.ParseBool(ctx.FormValue("sort"))
+
+	value, err := formats.Format(format, []byte(ctx.FormValue("value")), sortKeys)
+	if err != nil {
+		return errorJSON(ctx, http.StatusBadRequest, err.Error())
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"format": format, "value": string(value)})
+}
+
+// checkFormat validates the value of a put against the format of its key
+// when the request sets validateFormat.
+func checkFormat(ctx echo.Context, key string, value []byte) error {
+	if validate, _ := strconv.ParseBool(ctx.FormValue("validateFormat")); !validate {
+		return nil
+	}
+	if format := formats.ForKey(key); format != "" {
+		return formats.Validate(format, value)
+	}
+	return nil
+}
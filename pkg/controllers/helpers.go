@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/apiv1/types"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/etcd"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/middlewares"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/schemas"
+)
+
+// errorJSON writes an error the way the bundled UI expects it: HTTP 200 with
+// an errorCode and a message.
+func errorJSON(ctx echo.Context, code int, message string) error {
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"errorCode": code, "message": message})
+}
+
+// schemaErrorJSON reports a value rejected by schemas.Validate, with the path
+// of every violation when the value did not match its schema.
+func schemaErrorJSON(ctx echo.Context, err error) error {
+	verr, ok := err.(*schemas.ValidationError)
+	if !ok {
+		return errorJSON(ctx, http.StatusBadRequest, err.Error())
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"errorCode": http.StatusBadRequest,
+		"message":   verr.Error(),
+		"schema":    verr.Schema,
+		"errors":    verr.Errors,
+	})
+}
+
+// splitList splits a comma separated form value, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// confirmed reports whether the request echoes the target of a destructive
+// operation in its confirm parameter.
+func confirmed(ctx echo.Context, target string) bool {
+	return target != "" && strings.TrimSpace(ctx.FormValue("confirm")) == target
+}
+
+// userClientV3 leases a v3 client for the logged in user of the request.
+func userClientV3(ctx echo.Context) (*etcd.ClientV3, error) {
+	userInfo, ok := middlewares.GetUserInfo(ctx)
+	if !ok {
+		return nil, errors.New("Missing User's info. Login again")
+	}
+	return etcd.GetClientV3(*userInfo)
+}
+
+// leaseString formats the lease of a key for node responses, empty when the
+// key has no lease.
+func leaseString(lease int64) string {
+	if lease == 0 {
+		return ""
+	}
+	return etcd.FormatID(uint64(lease))
+}
+
+// valueEncoding parses the encoding parameter of a request, auto by default.
+func valueEncoding(ctx echo.Context) (string, error) {
+	return types.ParseEncoding(ctx.FormValue("encoding"), types.EncodingAuto)
+}
+
+// setValue sets the value of a node response in the requested encoding along
+// with the encoding used and whether the value is binary.
+func setValue(node map[string]interface{}, value []byte, encoding string) {
+	node["value"], node["encoding"] = types.EncodeValue(value, encoding)
+	node["binary"] = types.IsBinary(value)
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/audit"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/etcd"
+)
+
+func GetLeasesV3(ctx echo.Context) error {
+	withKeys, _ := strconv.ParseBool(ctx.FormValue("keys"))
+	cli, err := userClientV3(ctx)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	defer cli.Release()
+
+	leases, err := etcd.ListLeasesV3(ctx.Request().Context(), cli, withKeys)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"leases": leases})
+}
+
+func GetLeaseV3(ctx echo.Context) error {
+	id, err := leaseID(ctx)
+	if err != nil {
+		return errorJSON(ctx, http.StatusBadRequest, err.Error())
+	}
+	cli, err := userClientV3(ctx)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	defer cli.Release()
+
+	lease, err := etcd.GetLeaseV3(ctx.Request().Context(), cli, id)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	if lease.TTL == -1 {
+		return errorJSON(ctx, http.StatusNotFound, "The lease does not exist.")
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"lease": lease})
+}
+
+func RevokeLeaseV3(ctx echo.Context) error {
+	id, err := leaseID(ctx)
+	if err != nil {
+		return errorJSON(ctx, http.StatusBadRequest, err.Error())
+	}
+	cli, err := userClientV3(ctx)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	defer cli.Release()
+
+	err = etcd.RevokeLeaseV3(ctx.Request().Context(), cli, id)
+	audit.Record(ctx, "lease.revoke", map[string]interface{}{"id": etcd.FormatID(uint64(id))}, err)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	return ctx.String(http.StatusOK, "ok")
+}
+
+func KeepAliveLeaseV3(ctx echo.Context) error {
+	id, err := leaseID(ctx)
+	if err != nil {
+		return errorJSON(ctx, http.StatusBadRequest, err.Error())
+	}
+	cli, err := userClientV3(ctx)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	defer cli.Release()
+
+	ttl, err := etcd.KeepAliveOnceV3(ctx.Request().Context(), cli, id)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"id": etcd.FormatID(uint64(id)), "ttl": ttl})
+}
+
+// leaseID parses the hexadecimal lease ID of the request, as printed by
+// etcdctl and returned by the lease endpoints.
+func leaseID(ctx echo.Context) (int64, error) {
+	id, err := etcd.ParseID(ctx.FormValue("id"))
+	if err != nil {
+		return 0, errors.New("invalid lease id " + ctx.FormValue("id"))
+	}
+	return int64(id), nil
+}
@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/audit"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/etcd"
+)
+
+func CompactV3(ctx echo.Context) error {
+	revision, err := strconv.ParseInt(ctx.FormValue("revision"), 10, 64)
+	if err != nil || revision <= 0 {
+		return errorJSON(ctx, http.StatusBadRequest, "revision must be a positive integer")
+	}
+	if !confirmed(ctx, ctx.FormValue("revision")) {
+		return errorJSON(ctx, http.StatusBadRequest, "confirm must be set to the revision")
+	}
+	physical, _ := strconv.ParseBool(ctx.FormValue("physical"))
+
+	cli, err := userClientV3(ctx)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	defer cli.Release()
+
+	current, err := etcd.CompactV3(ctx.Request().Context(), cli, revision, physical)
+	audit.Record(ctx, "compact", map[string]interface{}{"revision": revision, "physical": physical}, err)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"revision": revision, "currentRevision": current})
+}
+
+func DefragmentV3(ctx echo.Context) error {
+	memberID := ctx.FormValue("id")
+	id, err := etcd.ParseID(memberID)
+	if err != nil {
+		return errorJSON(ctx, http.StatusBadRequest, "invalid member id "+memberID)
+	}
+	if !confirmed(ctx, memberID) {
+		return errorJSON(ctx, http.StatusBadRequest, "confirm must be set to the member id")
+	}
+
+	cli, err := userClientV3(ctx)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	defer cli.Release()
+
+	status, err := etcd.DefragmentV3(ctx.Request().Context(), cli, id)
+	audit.Record(ctx, "defragment", map[string]interface{}{"id": etcd.FormatID(id)}, err)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"member": status})
+}
+
+func GetAlarmsV3(ctx echo.Context) error {
+	cli, err := userClientV3(ctx)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	defer cli.Release()
+
+	alarms, err := etcd.ListAlarmsV3(ctx.Request().Context(), cli)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"alarms": alarms})
+}
+
+// DisarmAlarmV3 disarms the alarm named by alarm on member id. Leaving both
+// empty disarms every alarm, which must be confirmed with confirm=all.
+func DisarmAlarmV3(ctx echo.Context) error {
+	var (
+		memberID = ctx.FormValue("id")
+		name     = ctx.FormValue("alarm")
+		id       uint64
+		err      error
+	)
+	if memberID != "" {
+		if id, err = etcd.ParseID(memberID); err != nil {
+			return errorJSON(ctx, http.StatusBadRequest, "invalid member id "+memberID)
+		}
+	}
+	alarm, err := etcd.ParseAlarm(name)
+	if err != nil {
+		return errorJSON(ctx, http.StatusBadRequest, err.Error())
+	}
+	target := "all"
+	if memberID != "" || name != "" {
+		target = alarm.String()
+	}
+	if !confirmed(ctx, target) {
+		return errorJSON(ctx, http.StatusBadRequest, fmt.Sprintf("confirm must be set to %s", target))
+	}
+
+	cli, err := userClientV3(ctx)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	defer cli.Release()
+
+	alarms, err := etcd.DisarmAlarmV3(ctx.Request().Context(), cli, id, alarm)
+	audit.Record(ctx, "alarm.disarm", map[string]interface{}{"id": memberID, "alarm": target}, err)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"disarmed": alarms})
+}
+
+func SnapshotV3(ctx echo.Context) error {
+	cli, err := userClientV3(ctx)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	defer cli.Release()
+
+	rc, err := etcd.SnapshotV3(ctx.Request().Context(), cli)
+	audit.Record(ctx, "snapshot", nil, err)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	defer rc.Close()
+
+	filename := fmt.Sprintf("etcd-snapshot-%s.db", time.Now().UTC().Format("20060102T150405Z"))
+	ctx.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	return ctx.Stream(http.StatusOK, echo.MIMEOctetStream, rc)
+}
@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/audit"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/protos"
+)
+
+// maxDescriptorSetSize bounds uploaded descriptor sets.
+const maxDescriptorSetSize = 16 << 20
+
+func GetProtosV3(ctx echo.Context) error {
+	registry := protos.Default()
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"descriptorSets": registry.DescriptorSets(),
+		"messages":       registry.Messages(),
+		"mappings":       registry.Mappings(),
+	})
+}
+
+func UploadDescriptorSetV3(ctx echo.Context) error {
+	name := ctx.FormValue("name")
+	file, err := ctx.FormFile("file")
+	if err != nil {
+		return errorJSON(ctx, http.StatusBadRequest, "file is required")
+	}
+	if file.Size > maxDescriptorSetSize {
+		return errorJSON(ctx, http.StatusBadRequest, "descriptor set is too large")
+	}
+	if name == "" {
+		// foo.pb is saved as foo, not foo.pb.pb.
+		name = strings.TrimSuffix(file.Filename, filepath.Ext(file.Filename))
+	}
+	f, err := file.Open()
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+
+	err = protos.Default().AddDescriptorSet(name, data)
+	audit.Record(ctx, "proto.descriptors.add", map[string]interface{}{"name": name, "size": len(data)}, err)
+	if err != nil {
+		return errorJSON(ctx, http.StatusBadRequest, err.Error())
+	}
+	return GetProtosV3(ctx)
+}
+
+func RemoveDescriptorSetV3(ctx echo.Context) error {
+	name := ctx.FormValue("name")
+	err := protos.Default().RemoveDescriptorSet(name)
+	audit.Record(ctx, "proto.descriptors.remove", map[string]interface{}{"name": name}, err)
+	if err != nil {
+		return errorJSON(ctx, http.StatusBadRequest, err.Error())
+	}
+	return GetProtosV3(ctx)
+}
+
+func SetProtoMappingV3(ctx echo.Context) error {
+	pattern, message := ctx.FormValue("pattern"), ctx.FormValue("message")
+	if pattern == "" || message == "" {
+		return errorJSON(ctx, http.StatusBadRequest, "pattern and message are required")
+	}
+	err := protos.Default().SetMapping(pattern, message)
+	audit.Record(ctx, "proto.mapping.set", map[string]interface{}{"pattern": pattern, "message": message}, err)
+	if err != nil {
+		return errorJSON(ctx, http.StatusBadRequest, err.Error())
+	}
+	return GetProtosV3(ctx)
+}
+
+func RemoveProtoMappingV3(ctx echo.Context) error {
+	pattern := ctx.FormValue("pattern")
+	err := protos.Default().RemoveMapping(pattern)
+	audit.Record(ctx, "proto.mapping.remove", map[string]interface{}{"pattern": pattern}, err)
+	if err != nil {
+		return errorJSON(ctx, http.StatusBadRequest, err.Error())
+	}
+	return GetProtosV3(ctx)
+}
+
+// setProtoJSON adds the JSON rendering of a value to its node when the key
+// is mapped to a message type, or the reason it could not be decoded.
+func setProtoJSON(node map[string]interface{}, key string, value []byte) {
+	md, ok := protos.Default().Lookup(key)
+	if !ok {
+		return
+	}
+	node["message"] = string(md.FullName())
+	if data, err := protos.ToJSON(md, value); err != nil {
+		node["jsonError"] = err.Error()
+	} else {
+		node["json"] = string(data)
+	}
+}
+
+// protoValue encodes the JSON rendering of a message sent for key.
+func protoValue(key, value string) ([]byte, error) {
+	md, ok := protos.Default().Lookup(key)
+	if !ok {
+		return nil, fmt.Errorf("key %s is not mapped to a message type", key)
+	}
+	return protos.FromJSON(md, []byte(value))
+}
@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/trinhdaiphuc/etcdkeeper/config"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/etcd"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/middlewares"
+)
+
+const defaultSearchLimit = 100
+
+// SearchV3 searches the keys under key that the user may read.
+//
+//	pattern     glob (default) or regular expression matched against keys
+//	mode        "glob" or "regex", how pattern is interpreted
+//	value       substring (default) or regular expression searched in values
+//	valueMode   "substring" or "regex", how value is interpreted
+//	ignoreCase  "true" to match pattern and value case-insensitively
+//	limit       maximum number of results, 100 by default
+func SearchV3(ctx echo.Context) error {
+	var (
+		separator     = config.GetConfig().Separator
+		prefix        = ctx.FormValue("key")
+		ignoreCase, _ = strconv.ParseBool(ctx.FormValue("ignoreCase"))
+	)
+	if prefix == "" {
+		prefix = separator
+	}
+	query, err := etcd.ParseSearchQuery(ctx.FormValue("pattern"), ctx.FormValue("mode"),
+		ctx.FormValue("value"), ctx.FormValue("valueMode"), ignoreCase, separator)
+	if err != nil {
+		return errorJSON(ctx, http.StatusBadRequest, err.Error())
+	}
+	query.Limit = defaultSearchLimit
+	if limit := ctx.FormValue("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return errorJSON(ctx, http.StatusBadRequest, "limit must be a positive integer")
+		}
+		query.Limit = n
+	}
+
+	userInfo, ok := middlewares.GetUserInfo(ctx)
+	if !ok {
+		return ctx.String(http.StatusOK, "Missing User's info. Login again")
+	}
+	cli, err := etcd.GetClientV3(*userInfo)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	defer cli.Release()
+
+	permissions, err := etcd.GetPermissionPrefix(ctx.Request().Context(), *userInfo, prefix)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	query.Ranges = etcd.SearchRanges(permissions, prefix, separator)
+
+	resp, err := etcd.SearchV3(ctx.Request().Context(), cli, query)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	return ctx.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/apiv1/types"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/etcd"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/schemas"
+)
+
+type txnRequest struct {
+	etcd.Txn
+	// Encoding is the encoding of every value of the request and response.
+	Encoding string `json:"encoding"`
+	// ValidateFormat rejects puts whose value does not parse in the format
+	// of their key, as on PutV3.
+	ValidateFormat bool `json:"validateFormat"`
+}
+
+// TxnV3 runs a transaction described by the JSON body. Puts in either branch
+// are validated against the value schemas before anything is sent.
+func TxnV3(ctx echo.Context) error {
+	var req txnRequest
+	if err := ctx.Bind(&req); err != nil {
+		return errorJSON(ctx, http.StatusBadRequest, err.Error())
+	}
+	encoding, err := types.ParseEncoding(req.Encoding, types.EncodingAuto)
+	if err != nil {
+		return errorJSON(ctx, http.StatusBadRequest, err.Error())
+	}
+
+	cli, err := userClientV3(ctx)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	defer cli.Release()
+
+	list, err := schemas.ForV3(ctx.Request().Context(), cli.Host)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	for _, b := range []struct {
+		name string
+		ops  []etcd.TxnOp
+	}{{"success", req.Success}, {"failure", req.Failure}} {
+		for i, err := range schemas.ValidateOps(list, b.ops, encoding, req.ValidateFormat) {
+			if _, ok := err.(*schemas.ValidationError); ok {
+				return schemaErrorJSON(ctx, err)
+			}
+			if err != nil {
+				return errorJSON(ctx, http.StatusBadRequest, fmt.Sprintf("%s op %d: %v", b.name, i, err))
+			}
+		}
+	}
+
+	result, err := etcd.TxnV3(ctx.Request().Context(), cli, req.Txn, encoding)
+	if errors.Is(err, etcd.ErrInvalidTxn) {
+		return errorJSON(ctx, http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	return ctx.JSON(http.StatusOK, result)
+}
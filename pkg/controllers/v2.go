@@ -1,14 +1,15 @@
 package controllers
 
 import (
-	"context"
 	"encoding/json"
-	"github.com/coreos/etcd/client"
 	"github.com/labstack/echo/v4"
 	"github.com/trinhdaiphuc/etcdkeeper/config"
 	"github.com/trinhdaiphuc/etcdkeeper/pkg/etcd"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/logging"
 	"github.com/trinhdaiphuc/etcdkeeper/pkg/middlewares"
-	"log"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/schemas"
+	"go.etcd.io/etcd/client/v2"
+	"go.uber.org/zap"
 	"net/http"
 	"strconv"
 	"strings"
@@ -42,15 +43,16 @@ func ConnectV2(ctx echo.Context) error {
 	if err != nil {
 		return ctx.JSON(http.StatusOK, map[string]interface{}{"status": "error", "message": err.Error()})
 	}
+	defer client.Release()
 
-	info, err := etcd.GetInfoV2(client)
+	info, err := etcd.GetInfoV2(ctx.Request().Context(), client)
 	if err != nil {
-		ctx.JSON(http.StatusOK, map[string]interface{}{"status": "error", "message": err.Error()})
+		return ctx.JSON(http.StatusOK, map[string]interface{}{"status": "error", "message": err.Error()})
 	}
 
 	token, err := middlewares.NewToken(userInfo)
 	if err != nil {
-		ctx.JSON(http.StatusOK, map[string]interface{}{"status": "error", "message": err.Error()})
+		return ctx.JSON(http.StatusOK, map[string]interface{}{"status": "error", "message": err.Error()})
 	}
 	return ctx.JSON(http.StatusOK, map[string]interface{}{"status": "running", "info": info, "token": token})
 }
@@ -60,39 +62,50 @@ func PutV2(ctx echo.Context) error {
 	value := ctx.FormValue("value")
 	ttl := ctx.FormValue("ttl")
 	dir := ctx.FormValue("dir")
-	log.Println("PUT v2", key)
-
 	userInfo, ok := middlewares.GetUserInfo(ctx)
 	if !ok {
 		return ctx.String(http.StatusOK, "Missing User's info. Login again")
 	}
 	cli, err := etcd.GetClientV2(*userInfo)
 	if err != nil {
-		ctx.String(http.StatusOK, err.Error())
+		return ctx.String(http.StatusOK, err.Error())
 	}
-	kapi := client.NewKeysAPI(cli)
+	defer cli.Release()
+	kapi := etcd.NewKeysAPI(cli)
 
 	var isDir bool
 	if dir != "" {
 		isDir, _ = strconv.ParseBool(dir)
 	}
+	if !isDir {
+		list, err := schemas.ForV2(ctx.Request().Context(), cli.Host)
+		if err != nil {
+			return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+		}
+		if err = schemas.Validate(list, key, []byte(value)); err != nil {
+			return schemaErrorJSON(ctx, err)
+		}
+		if err = checkFormat(ctx, key, []byte(value)); err != nil {
+			return errorJSON(ctx, http.StatusBadRequest, err.Error())
+		}
+	}
 
 	data := make(map[string]interface{})
 	if ttl != "" {
 		var sec int64
 		sec, err = strconv.ParseInt(ttl, 10, 64)
 		if err != nil {
-			log.Println(err.Error())
+			logging.FromContext(ctx.Request().Context()).Warn("invalid ttl, setting the key without it", zap.String("ttl", ttl))
 		}
-		_, err = kapi.Set(context.Background(), key, value, &client.SetOptions{TTL: time.Duration(sec) * time.Second, Dir: isDir})
+		_, err = kapi.Set(ctx.Request().Context(), key, value, &client.SetOptions{TTL: time.Duration(sec) * time.Second, Dir: isDir})
 	} else {
-		_, err = kapi.Set(context.Background(), key, value, &client.SetOptions{Dir: isDir})
+		_, err = kapi.Set(ctx.Request().Context(), key, value, &client.SetOptions{Dir: isDir})
 	}
 	if err != nil {
 		data["errorCode"] = 500
 		data["message"] = err.Error()
 	} else {
-		if resp, err := kapi.Get(context.Background(), key, &client.GetOptions{Recursive: true, Sort: true}); err != nil {
+		if resp, err := kapi.Get(ctx.Request().Context(), key, &client.GetOptions{Recursive: true, Sort: true}); err != nil {
 			data["errorCode"] = err.Error()
 		} else {
 			if resp.Node != nil {
@@ -119,8 +132,6 @@ func GetV2(ctx echo.Context) error {
 	key := ctx.FormValue("key")
 	data := make(map[string]interface{})
 	separator := config.GetConfig().Separator
-	log.Println("GET v2", key)
-
 	userInfo, ok := middlewares.GetUserInfo(ctx)
 	if !ok {
 		return ctx.String(http.StatusOK, "Missing User's info. Login again")
@@ -128,14 +139,15 @@ func GetV2(ctx echo.Context) error {
 
 	cli, err := etcd.GetClientV2(*userInfo)
 	if err != nil {
-		ctx.JSON(http.StatusOK, err.Error())
+		return ctx.JSON(http.StatusOK, err.Error())
 	}
-	kapi := client.NewKeysAPI(cli)
+	defer cli.Release()
+	kapi := etcd.NewKeysAPI(cli)
 
 	var permissions [][]string
 	if ctx.FormValue("prefix") == "true" {
 		var e error
-		permissions, e = etcd.GetPermissionPrefixV2(*userInfo, key)
+		permissions, e = etcd.GetPermissionPrefixV2(ctx.Request().Context(), *userInfo, key)
 		if e != nil {
 			return ctx.String(http.StatusOK, e.Error())
 		}
@@ -143,18 +155,9 @@ func GetV2(ctx echo.Context) error {
 		permissions = [][]string{{key, ""}}
 	}
 
-	var (
-		min, max int
-	)
-	if key == separator {
-		min = 1
-	} else {
-		min = len(strings.Split(key, separator))
-	}
-	max = min
-	all := make(map[int][]map[string]interface{})
+	tree := etcd.NewTree(key, separator)
 	if key == separator {
-		all[min] = []map[string]interface{}{{"key": key, "value": "", "dir": true, "nodes": make([]map[string]interface{}, 0)}}
+		tree.Add(key, map[string]interface{}{"value": "", "dir": true})
 	}
 	for _, p := range permissions {
 		pKey, pRange := p[0], p[1]
@@ -165,7 +168,7 @@ func GetV2(ctx echo.Context) error {
 			}
 			opt = &client.GetOptions{Recursive: true, Sort: true}
 		}
-		if resp, err := kapi.Get(context.Background(), pKey, opt); err != nil {
+		if resp, err := kapi.Get(ctx.Request().Context(), pKey, opt); err != nil {
 			data["errorCode"] = 500
 			data["message"] = err.Error()
 		} else {
@@ -173,34 +176,13 @@ func GetV2(ctx echo.Context) error {
 				data["errorCode"] = 500
 				data["message"] = "The node does not exist."
 			} else {
-				max = etcd.GetNode(resp.Node, key, all, min, max)
-			}
-		}
-	}
-
-	// parent-child mapping
-	for i := max; i > min; i-- {
-		for _, a := range all[i] {
-			for _, pa := range all[i-1] {
-				if i == 2 { // The last is root
-					pa["nodes"] = append(pa["nodes"].([]map[string]interface{}), a)
-					pa["dir"] = true
-				} else {
-					if strings.HasPrefix(a["key"].(string), pa["key"].(string)+separator) {
-						pa["nodes"] = append(pa["nodes"].([]map[string]interface{}), a)
-						pa["dir"] = true
-					}
-				}
+				etcd.AddNodeV2(tree, resp.Node)
 			}
 		}
 	}
 
-	for _, n := range all[min] {
-		if n["key"] == key {
-			etcd.NodesSort(n)
-			data["node"] = n
-			break
-		}
+	if tree.Found() {
+		data["node"] = tree.Root()
 	}
 
 	var dataByte []byte
@@ -213,25 +195,24 @@ func GetV2(ctx echo.Context) error {
 func DelV2(ctx echo.Context) error {
 	key := ctx.FormValue("key")
 	dir := ctx.FormValue("dir")
-	log.Println("DELETE v2", key)
-
 	userInfo, ok := middlewares.GetUserInfo(ctx)
 	if !ok {
 		return ctx.String(http.StatusOK, "Missing User's info. Login again")
 	}
 	cli, err := etcd.GetClientV2(*userInfo)
 	if err != nil {
-		ctx.String(http.StatusOK, err.Error())
+		return ctx.String(http.StatusOK, err.Error())
 	}
-	kapi := client.NewKeysAPI(cli)
+	defer cli.Release()
+	kapi := etcd.NewKeysAPI(cli)
 
 	isDir, _ := strconv.ParseBool(dir)
 	if isDir {
-		if _, err := kapi.Delete(context.Background(), key, &client.DeleteOptions{Recursive: true, Dir: true}); err != nil {
+		if _, err := kapi.Delete(ctx.Request().Context(), key, &client.DeleteOptions{Recursive: true, Dir: true}); err != nil {
 			return ctx.String(http.StatusOK, err.Error())
 		}
 	} else {
-		if _, err := kapi.Delete(context.Background(), key, nil); err != nil {
+		if _, err := kapi.Delete(ctx.Request().Context(), key, nil); err != nil {
 			return ctx.String(http.StatusOK, err.Error())
 		}
 	}
@@ -242,3 +223,7 @@ func DelV2(ctx echo.Context) error {
 func GetPathV2(ctx echo.Context) error {
 	return GetV2(ctx)
 }
+
+func GetPoolV2(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, etcd.PoolStatsV2())
+}
@@ -1,13 +1,14 @@
 package controllers
 
 import (
-	"context"
 	"encoding/json"
-	"github.com/coreos/etcd/clientv3"
 	"github.com/labstack/echo/v4"
 	"github.com/trinhdaiphuc/etcdkeeper/config"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/apiv1/types"
 	"github.com/trinhdaiphuc/etcdkeeper/pkg/etcd"
 	"github.com/trinhdaiphuc/etcdkeeper/pkg/middlewares"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/schemas"
+	clientv3 "go.etcd.io/etcd/client/v3"
 	"net/http"
 	"strconv"
 	"strings"
@@ -53,15 +54,16 @@ func ConnectV3(ctx echo.Context) error {
 	if err != nil {
 		return ctx.JSON(http.StatusOK, map[string]interface{}{"status": "error", "message": err.Error()})
 	}
+	defer client.Release()
 
-	info, err := etcd.GetInfoV3(client)
+	info, err := etcd.GetInfoV3(ctx.Request().Context(), client)
 	if err != nil {
-		ctx.JSON(http.StatusOK, map[string]interface{}{"status": "error", "message": err.Error()})
+		return ctx.JSON(http.StatusOK, map[string]interface{}{"status": "error", "message": err.Error()})
 	}
 
 	token, err := middlewares.NewToken(userInfo)
 	if err != nil {
-		ctx.JSON(http.StatusOK, map[string]interface{}{"status": "error", "message": err.Error()})
+		return ctx.JSON(http.StatusOK, map[string]interface{}{"status": "error", "message": err.Error()})
 	}
 
 	return ctx.JSON(http.StatusOK, map[string]interface{}{"status": "running", "info": info, "token": token})
@@ -77,39 +79,73 @@ func PutV3(ctx echo.Context) error {
 	}
 	cli, err := etcd.GetClientV3(*userInfo)
 	if err != nil {
-		ctx.String(http.StatusOK, err.Error())
+		return ctx.String(http.StatusOK, err.Error())
+	}
+	defer cli.Release()
+
+	encoding, err := valueEncoding(ctx)
+	if err != nil {
+		return errorJSON(ctx, http.StatusBadRequest, err.Error())
+	}
+	var raw []byte
+	if protoJSON, _ := strconv.ParseBool(ctx.FormValue("protoJSON")); protoJSON {
+		raw, err = protoValue(key, value)
+	} else {
+		raw, err = types.DecodeValue(value, encoding)
+	}
+	if err != nil {
+		return errorJSON(ctx, http.StatusBadRequest, err.Error())
+	}
+	if encoding == types.EncodingText {
+		encoding = types.EncodingAuto
+	}
+	list, err := schemas.ForV3(ctx.Request().Context(), cli.Host)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	if err = schemas.Validate(list, key, raw); err != nil {
+		return schemaErrorJSON(ctx, err)
+	}
+	if err = checkFormat(ctx, key, raw); err != nil {
+		return errorJSON(ctx, http.StatusBadRequest, err.Error())
 	}
 
 	data := make(map[string]interface{})
+	var lease etcd.PutLease
 	if ttl != "" {
-		var sec int64
-		sec, err = strconv.ParseInt(ttl, 10, 64)
-		if err != nil {
-			ctx.Logger().Error(err)
+		if lease.TTL, err = strconv.ParseInt(ttl, 10, 64); err != nil {
+			return errorJSON(ctx, http.StatusBadRequest, "invalid ttl "+ttl)
 		}
-		var leaseResp *clientv3.LeaseGrantResponse
-		leaseResp, err = cli.Grant(context.TODO(), sec)
-		if err == nil && leaseResp != nil {
-			_, err = cli.Put(context.Background(), key, value, clientv3.WithLease(leaseResp.ID))
+	}
+	if id := ctx.FormValue("lease"); id != "" {
+		leaseID, err := etcd.ParseID(id)
+		if err != nil {
+			return errorJSON(ctx, http.StatusBadRequest, "invalid lease id "+id)
 		}
-	} else {
-		_, err = cli.Put(context.Background(), key, value)
+		lease.ID = int64(leaseID)
+	}
+	lease.Detach, _ = strconv.ParseBool(ctx.FormValue("detach"))
+	if err = lease.Check(); err != nil {
+		return errorJSON(ctx, http.StatusBadRequest, err.Error())
 	}
+	err = etcd.PutV3(ctx.Request().Context(), cli, key, string(raw), lease)
 	if err != nil {
 		data["errorCode"] = 500
 		data["message"] = err.Error()
 	} else {
-		if resp, err := cli.Get(context.Background(), key); err != nil {
+		if resp, err := cli.Get(ctx.Request().Context(), key); err != nil {
 			data["errorCode"] = 500
-			data["errorCode"] = err.Error()
+			data["message"] = err.Error()
 		} else {
 			if resp.Count > 0 {
 				kv := resp.Kvs[0]
 				node := make(map[string]interface{})
 				node["key"] = string(kv.Key)
-				node["value"] = string(kv.Value)
+				setValue(node, kv.Value, encoding)
+				setProtoJSON(node, key, kv.Value)
 				node["dir"] = false
-				node["ttl"] = etcd.GetTTL(cli, kv.Lease)
+				node["ttl"] = etcd.GetTTL(ctx.Request().Context(), cli, kv.Lease)
+				node["lease"] = leaseString(kv.Lease)
 				node["createdIndex"] = kv.CreateRevision
 				node["modifiedIndex"] = kv.ModRevision
 				data["node"] = node
@@ -127,8 +163,6 @@ func PutV3(ctx echo.Context) error {
 func GetV3(ctx echo.Context) error {
 	data := make(map[string]interface{})
 	key := ctx.FormValue("key")
-	ctx.Logger().Info("GET v3", key)
-
 	userInfo, ok := middlewares.GetUserInfo(ctx)
 	if !ok {
 		return ctx.String(http.StatusOK, "Missing User's info. Login again")
@@ -136,10 +170,16 @@ func GetV3(ctx echo.Context) error {
 
 	cli, err := etcd.GetClientV3(*userInfo)
 	if err != nil {
-		ctx.JSON(http.StatusOK, err.Error())
+		return ctx.JSON(http.StatusOK, err.Error())
 	}
+	defer cli.Release()
 
-	permissions, err := etcd.GetPermissionPrefix(*userInfo, key)
+	encoding, err := valueEncoding(ctx)
+	if err != nil {
+		return errorJSON(ctx, http.StatusBadRequest, err.Error())
+	}
+
+	permissions, err := etcd.GetPermissionPrefix(ctx.Request().Context(), *userInfo, key)
 	if err != nil {
 		return ctx.String(http.StatusOK, err.Error())
 	}
@@ -158,9 +198,9 @@ func GetV3(ctx echo.Context) error {
 				if p[0] == "/" {
 					prefixKey = ""
 				}
-				resp, err = cli.Get(context.Background(), prefixKey, clientv3.WithPrefix())
+				resp, err = cli.Get(ctx.Request().Context(), prefixKey, clientv3.WithPrefix())
 			} else {
-				resp, err = cli.Get(context.Background(), p[0])
+				resp, err = cli.Get(ctx.Request().Context(), p[0])
 			}
 			if err != nil {
 				data["errorCode"] = 500
@@ -169,10 +209,10 @@ func GetV3(ctx echo.Context) error {
 				for _, kv := range resp.Kvs {
 					node := make(map[string]interface{})
 					node["key"] = string(kv.Key)
-					node["value"] = string(kv.Value)
+					setValue(node, kv.Value, encoding)
 					node["dir"] = false
 					if key == string(kv.Key) {
-						node["ttl"] = etcd.GetTTL(cli, kv.Lease)
+						node["ttl"] = etcd.GetTTL(ctx.Request().Context(), cli, kv.Lease)
 					} else {
 						node["ttl"] = 0
 					}
@@ -185,7 +225,7 @@ func GetV3(ctx echo.Context) error {
 		}
 		data["node"] = pnode
 	} else {
-		if resp, err := cli.Get(context.Background(), key); err != nil {
+		if resp, err := cli.Get(ctx.Request().Context(), key); err != nil {
 			data["errorCode"] = 500
 			data["message"] = err.Error()
 		} else {
@@ -193,9 +233,11 @@ func GetV3(ctx echo.Context) error {
 				kv := resp.Kvs[0]
 				node := make(map[string]interface{})
 				node["key"] = string(kv.Key)
-				node["value"] = string(kv.Value)
+				setValue(node, kv.Value, encoding)
+				setProtoJSON(node, key, kv.Value)
 				node["dir"] = false
-				node["ttl"] = etcd.GetTTL(cli, kv.Lease)
+				node["ttl"] = etcd.GetTTL(ctx.Request().Context(), cli, kv.Lease)
+				node["lease"] = leaseString(kv.Lease)
 				node["createdIndex"] = kv.CreateRevision
 				node["modifiedIndex"] = kv.ModRevision
 				data["node"] = node
@@ -218,18 +260,11 @@ func GetPathV3(ctx echo.Context) error {
 		data      = make(map[string]interface{})
 		dataByte  []byte
 		separator = config.GetConfig().Separator
-		/*
-			{1:["/"], 2:["/foo", "/foo2"], 3:["/foo/bar", "/foo2/bar"], 4:["/foo/bar/test"]}
-		*/
-		all       = make(map[int][]map[string]interface{})
-		min       int
-		max       int
 		originKey = ctx.FormValue("key")
+		tree      = etcd.NewTree(originKey, separator)
 		// parent
 		presp *clientv3.GetResponse
 	)
-	ctx.Logger().Info("GET v3", originKey)
-
 	userInfo, ok := middlewares.GetUserInfo(ctx)
 	if !ok {
 		return ctx.String(http.StatusOK, "Missing User's info. Login again")
@@ -239,14 +274,24 @@ func GetPathV3(ctx echo.Context) error {
 	if err != nil {
 		return ctx.String(http.StatusOK, err.Error())
 	}
+	defer cli.Release()
 
-	permissions, err := etcd.GetPermissionPrefix(*userInfo, originKey)
+	encoding, err := valueEncoding(ctx)
+	if err != nil {
+		return errorJSON(ctx, http.StatusBadRequest, err.Error())
+	}
+
+	permissions, err := etcd.GetPermissionPrefix(ctx.Request().Context(), *userInfo, originKey)
 	if err != nil {
 		return ctx.String(http.StatusOK, err.Error())
 	}
 
+	if ctx.FormValue("lazy") == "true" {
+		return getChildrenV3(ctx, cli, permissions, originKey, encoding)
+	}
+
 	if originKey != separator {
-		presp, err = cli.Get(context.Background(), originKey)
+		presp, err = cli.Get(ctx.Request().Context(), originKey)
 		if err != nil {
 			data["errorCode"] = 500
 			data["message"] = err.Error()
@@ -255,31 +300,24 @@ func GetPathV3(ctx echo.Context) error {
 
 		}
 	}
-	if originKey == separator {
-		min = 1
-		//prefixKey = separator
-	} else {
-		min = len(strings.Split(originKey, separator))
-		//prefixKey = originKey
-	}
-	max = min
-	all[min] = []map[string]interface{}{{"key": originKey}}
 	if presp != nil && presp.Count != 0 {
-		all[min][0]["value"] = string(presp.Kvs[0].Value)
-		all[min][0]["ttl"] = etcd.GetTTL(cli, presp.Kvs[0].Lease)
-		all[min][0]["createdIndex"] = presp.Kvs[0].CreateRevision
-		all[min][0]["modifiedIndex"] = presp.Kvs[0].ModRevision
+		node := map[string]interface{}{
+			"ttl":           etcd.GetTTL(ctx.Request().Context(), cli, presp.Kvs[0].Lease),
+			"createdIndex":  presp.Kvs[0].CreateRevision,
+			"modifiedIndex": presp.Kvs[0].ModRevision,
+		}
+		setValue(node, presp.Kvs[0].Value, encoding)
+		tree.Add(originKey, node)
 	}
-	all[min][0]["nodes"] = make([]map[string]interface{}, 0)
 
 	for _, p := range permissions {
 		key, rangeEnd := p[0], p[1]
 		//child
 		var resp *clientv3.GetResponse
 		if rangeEnd != "" {
-			resp, err = cli.Get(context.Background(), key, clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+			resp, err = cli.Get(ctx.Request().Context(), key, clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
 		} else {
-			resp, err = cli.Get(context.Background(), key, clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+			resp, err = cli.Get(ctx.Request().Context(), key, clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
 		}
 		if err != nil {
 			data["errorCode"] = 500
@@ -289,66 +327,22 @@ func GetPathV3(ctx echo.Context) error {
 		}
 
 		for _, kv := range resp.Kvs {
-			if string(kv.Key) == separator {
+			if string(kv.Key) == separator || string(kv.Key) == originKey {
 				continue
 			}
-			keys := strings.Split(string(kv.Key), separator) // /foo/bar
-			for i := range keys {                            // ["", "foo", "bar"]
-				k := strings.Join(keys[0:i+1], separator)
-				if k == "" {
-					continue
-				}
-				node := map[string]interface{}{"key": k}
-				if node["key"].(string) == string(kv.Key) {
-					node["value"] = string(kv.Value)
-					if key == string(kv.Key) {
-						node["ttl"] = etcd.GetTTL(cli, kv.Lease)
-					} else {
-						node["ttl"] = 0
-					}
-					node["createdIndex"] = kv.CreateRevision
-					node["modifiedIndex"] = kv.ModRevision
-				}
-				level := len(strings.Split(k, separator))
-				if level > max {
-					max = level
-				}
-
-				if _, ok := all[level]; !ok {
-					all[level] = make([]map[string]interface{}, 0)
-				}
-				levelNodes := all[level]
-				var isExist bool
-				for _, n := range levelNodes {
-					if n["key"].(string) == k {
-						isExist = true
-					}
-				}
-				if !isExist {
-					node["nodes"] = make([]map[string]interface{}, 0)
-					all[level] = append(all[level], node)
-				}
+			node := map[string]interface{}{
+				"ttl":           0,
+				"createdIndex":  kv.CreateRevision,
+				"modifiedIndex": kv.ModRevision,
 			}
-		}
-	}
-
-	// parent-child mapping
-	for i := max; i > min; i-- {
-		for _, a := range all[i] {
-			for _, pa := range all[i-1] {
-				if i == 2 {
-					pa["nodes"] = append(pa["nodes"].([]map[string]interface{}), a)
-					pa["dir"] = true
-				} else {
-					if strings.HasPrefix(a["key"].(string), pa["key"].(string)+separator) {
-						pa["nodes"] = append(pa["nodes"].([]map[string]interface{}), a)
-						pa["dir"] = true
-					}
-				}
+			setValue(node, kv.Value, encoding)
+			if key == string(kv.Key) {
+				node["ttl"] = etcd.GetTTL(ctx.Request().Context(), cli, kv.Lease)
 			}
+			tree.Add(string(kv.Key), node)
 		}
 	}
-	data = all[min][0]
+	data = tree.Root()
 
 	if dataByte, err = json.Marshal(map[string]interface{}{"node": data}); err != nil {
 		return ctx.String(http.StatusOK, err.Error())
@@ -356,6 +350,57 @@ func GetPathV3(ctx echo.Context) error {
 	return ctx.String(http.StatusOK, string(dataByte))
 }
 
+// getChildrenV3 answers GetPathV3 in lazy mode: the node itself and only its
+// immediate children with their sizes. The after and limit parameters page
+// through nodes with many children, next is set when there are more.
+func getChildrenV3(ctx echo.Context, cli *etcd.ClientV3, permissions [][]string, key, encoding string) error {
+	separator := config.GetConfig().Separator
+	limit := etcd.DefaultChildLimit
+	if l := ctx.FormValue("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit <= 0 {
+			return errorJSON(ctx, http.StatusBadRequest, "limit must be a positive integer")
+		}
+	}
+
+	node := map[string]interface{}{"key": key, "dir": true}
+	if key != separator {
+		resp, err := cli.Get(ctx.Request().Context(), key)
+		if err != nil {
+			return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+		}
+		if resp.Count != 0 {
+			kv := resp.Kvs[0]
+			setValue(node, kv.Value, encoding)
+			node["ttl"] = etcd.GetTTL(ctx.Request().Context(), cli, kv.Lease)
+			node["lease"] = leaseString(kv.Lease)
+			node["createdIndex"] = kv.CreateRevision
+			node["modifiedIndex"] = kv.ModRevision
+		}
+	}
+
+	prefix := etcd.ChildrenPrefix(key, separator)
+	ranges := etcd.SearchRanges(permissions, prefix, separator)
+	page, err := etcd.ListChildrenV3(ctx.Request().Context(), cli, key, separator, ranges, ctx.FormValue("after"), limit)
+	if err != nil {
+		return errorJSON(ctx, http.StatusInternalServerError, err.Error())
+	}
+	nodes := make([]map[string]interface{}, 0, len(page.Children))
+	for _, c := range page.Children {
+		nodes = append(nodes, map[string]interface{}{
+			"key":      c.Key,
+			"dir":      c.Dir,
+			"hasValue": c.HasValue,
+			"count":    c.Count,
+		})
+	}
+	node["nodes"] = nodes
+	if page.Next != "" {
+		node["next"] = page.Next
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"node": node})
+}
+
 func DelV3(ctx echo.Context) error {
 	var (
 		request   Request
@@ -375,17 +420,20 @@ func DelV3(ctx echo.Context) error {
 	if err != nil {
 		return ctx.String(http.StatusOK, err.Error())
 	}
+	defer cli.Release()
 
-	ctx.Logger().Info("DELETE v3", request.Key)
-
-	if _, err = cli.Delete(context.Background(), request.Key); err != nil {
+	if _, err = cli.Delete(ctx.Request().Context(), request.Key); err != nil {
 		return ctx.String(http.StatusOK, err.Error())
 	}
 
 	if request.Dir {
-		if _, err = cli.Delete(context.Background(), request.Key+separator, clientv3.WithPrefix()); err != nil {
+		if _, err = cli.Delete(ctx.Request().Context(), request.Key+separator, clientv3.WithPrefix()); err != nil {
 			return ctx.String(http.StatusOK, err.Error())
 		}
 	}
 	return ctx.String(http.StatusOK, "ok")
 }
+
+func GetPoolV3(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, etcd.PoolStatsV3())
+}
@@ -0,0 +1,93 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// BatchV3 applies independent put and delete operations in as few
+// transactions of at most maxOps operations as it can, in order. etcd
+// refuses a transaction that writes the same key twice, so an operation
+// overlapping one already in the transaction starts the next one. When a
+// transaction fails its operations are retried one by one, so that only the
+// failing ones are reported. Operations whose result already holds an error
+// are skipped.
+func BatchV3(ctx context.Context, cli *ClientV3, ops []TxnOp, results []BatchResult, encoding string, maxOps int) {
+	var (
+		chunk   []int
+		pending []clientv3.Op
+	)
+	commit := func(indexes []int, txnOps []clientv3.Op) error {
+		resp, err := cli.Txn(ctx).Then(txnOps...).Commit()
+		if err != nil {
+			return err
+		}
+		for i, index := range indexes {
+			r := &results[index]
+			r.OK, r.Error = true, ""
+			r.Revision = resp.Header.Revision
+			if del := resp.Responses[i].GetResponseDeleteRange(); del != nil {
+				r.Deleted = del.Deleted
+			}
+		}
+		return nil
+	}
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		if err := commit(chunk, pending); err != nil {
+			// Find out which operations failed the transaction.
+			for i, index := range chunk {
+				if len(chunk) == 1 {
+					results[index].Error = err.Error()
+				} else if err := commit([]int{index}, pending[i:i+1]); err != nil {
+					results[index].Error = err.Error()
+				}
+			}
+		}
+		chunk, pending = chunk[:0], pending[:0]
+	}
+
+	for i, o := range ops {
+		results[i].Type, results[i].Key = o.Type, o.Key
+		if results[i].Error != "" {
+			continue
+		}
+		if o.Type != "put" && o.Type != "delete" {
+			results[i].Error = fmt.Sprintf("invalid type %q, expected put or delete", o.Type)
+			continue
+		}
+		op, err := txnOp(o, encoding)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		if len(pending) >= maxOps || overlaps(ops, chunk, o) {
+			flush()
+		}
+		chunk = append(chunk, i)
+		pending = append(pending, op)
+	}
+	flush()
+}
+
+// overlaps reports whether o touches a key written by the operations of
+// chunk.
+func overlaps(ops []TxnOp, chunk []int, o TxnOp) bool {
+	for _, i := range chunk {
+		c := ops[i]
+		switch {
+		case c.Key == o.Key:
+			return true
+		case c.Prefix && strings.HasPrefix(o.Key, c.Key):
+			return true
+		case o.Prefix && strings.HasPrefix(c.Key, o.Key):
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package etcd
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	childrenPageSize  = 500
+	childrenCountOps  = 64
+	DefaultChildLimit = 500
+)
+
+// ChildrenPrefix returns the prefix shared by the children of parent.
+func ChildrenPrefix(parent, separator string) string {
+	if parent == separator {
+		return separator
+	}
+	return parent + separator
+}
+
+// ListChildrenV3 lists up to limit immediate children of parent within
+// ranges, starting after the continuation key of a previous page. It only
+// reads keys: whenever a key below a child directory is found the rest of
+// that directory is skipped, so the cost depends on the number of children
+// rather than on the number of keys below them. Directory sizes are counted
+// afterwards in batched count-only transactions.
+func ListChildrenV3(ctx context.Context, cli *ClientV3, parent, separator string, ranges []KeyRange, after string, limit int) (*ChildrenPage, error) {
+	prefix := ChildrenPrefix(parent, separator)
+	if limit <= 0 {
+		limit = DefaultChildLimit
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Key < ranges[j].Key })
+
+	var (
+		page  = &ChildrenPage{Children: make([]Child, 0)}
+		index = make(map[string]int)
+		rev   int64
+	)
+	// add records a child and reports false once the page is full.
+	add := func(key string, dir bool) bool {
+		if i, ok := index[key]; ok {
+			page.Children[i].Dir = page.Children[i].Dir || dir
+			page.Children[i].HasValue = page.Children[i].HasValue || !dir
+			return true
+		}
+		if len(page.Children) >= limit {
+			return false
+		}
+		index[key] = len(page.Children)
+		page.Children = append(page.Children, Child{Key: key, Dir: dir, HasValue: !dir})
+		return true
+	}
+
+	for _, r := range ranges {
+		start, end := r.Key, r.Key+"\x00"
+		if r.Prefix {
+			if !strings.HasPrefix(r.Key, prefix) {
+				// The range covers the whole parent.
+				start = prefix
+			}
+			end = clientv3.GetPrefixRangeEnd(start)
+		}
+		if !strings.HasPrefix(start, prefix) {
+			continue
+		}
+		if after > start {
+			start = after
+		}
+
+	scan:
+		for start < end {
+			opts := []clientv3.OpOption{
+				clientv3.WithRange(end),
+				clientv3.WithKeysOnly(),
+				clientv3.WithLimit(childrenPageSize),
+				clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend),
+			}
+			if rev != 0 {
+				opts = append(opts, clientv3.WithRev(rev))
+			}
+			resp, err := cli.Get(ctx, start, opts...)
+			if err != nil {
+				return nil, err
+			}
+			rev = resp.Header.Revision
+			if len(resp.Kvs) == 0 {
+				break
+			}
+
+			for _, kv := range resp.Kvs {
+				key := string(kv.Key)
+				if key == parent {
+					continue
+				}
+				rest := key[len(prefix):]
+				i := strings.Index(rest, separator)
+				if i < 0 {
+					if !add(key, false) {
+						page.Next = key
+						break scan
+					}
+					continue
+				}
+				dir := prefix + rest[:i]
+				listed, err := listedBefore(ctx, cli, dir, after, rev)
+				if err != nil {
+					return nil, err
+				}
+				if !listed && !add(dir, true) {
+					page.Next = key
+					break scan
+				}
+				// Jump over everything below the directory.
+				start = clientv3.GetPrefixRangeEnd(dir + separator)
+				continue scan
+			}
+			if !resp.More {
+				break
+			}
+			start = string(resp.Kvs[len(resp.Kvs)-1].Key) + "\x00"
+		}
+		if page.Next != "" {
+			break
+		}
+	}
+
+	if err := countChildren(ctx, cli, page.Children, separator, rev); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// listedBefore reports whether dir was already returned by a previous page.
+// Children are not contiguous in key order ("/a", "/a-b", "/a/c"), so a
+// directory sorting before the continuation key may still be new; it was
+// only listed if it is a key of its own, which then was read as a leaf.
+func listedBefore(ctx context.Context, cli *ClientV3, dir, after string, rev int64) (bool, error) {
+	if after == "" || dir >= after {
+		return false, nil
+	}
+	resp, err := cli.Get(ctx, dir, clientv3.WithCountOnly(), clientv3.WithRev(rev))
+	if err != nil {
+		return false, err
+	}
+	return resp.Count > 0, nil
+}
+
+// countChildren fills in the number of keys below every child. A key that
+// has keys below it is a directory as well.
+func countChildren(ctx context.Context, cli *ClientV3, children []Child, separator string, rev int64) error {
+	for start := 0; start < len(children); start += childrenCountOps {
+		batch := children[start:]
+		if len(batch) > childrenCountOps {
+			batch = batch[:childrenCountOps]
+		}
+
+		ops := make([]clientv3.Op, 0, len(batch))
+		for _, c := range batch {
+			ops = append(ops, clientv3.OpGet(c.Key+separator,
+				clientv3.WithPrefix(), clientv3.WithCountOnly(), clientv3.WithRev(rev)))
+		}
+		resp, err := cli.Txn(ctx).Then(ops...).Commit()
+		if err != nil {
+			return err
+		}
+		for i, r := range resp.Responses {
+			batch[i].Count = r.GetResponseRange().Count
+			batch[i].Dir = batch[i].Dir || batch[i].Count > 0
+		}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/trinhdaiphuc/etcdkeeper/config"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// FormatID formats a member, cluster or lease ID the way etcdctl prints it.
+func FormatID(id uint64) string {
+	return fmt.Sprintf("%x", id)
+}
+
+// GetClusterStatusV3 queries Status on every member returned by MemberList
+// along with the active alarms. A member that cannot be reached is reported
+// with its errors instead of failing the whole request.
+func GetClusterStatusV3(ctx context.Context, cli *ClientV3) (*ClusterStatus, error) {
+	timeout := config.GetConfig().ConnectTimeout
+	listCtx, cancel := context.WithTimeout(ctx, timeout)
+	mems, err := cli.MemberList(listCtx)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+
+	status := &ClusterStatus{
+		ClusterID: FormatID(mems.Header.ClusterId),
+		Members:   make([]MemberStatus, len(mems.Members)),
+	}
+	var wg sync.WaitGroup
+	for i, m := range mems.Members {
+		wg.Add(1)
+		go func(i int, m *pb.Member) {
+			defer wg.Done()
+			status.Members[i] = memberStatus(ctx, cli, m, timeout)
+		}(i, m)
+	}
+	wg.Wait()
+
+	var leaderIndex uint64
+	for _, m := range status.Members {
+		if m.IsLeader {
+			status.Leader = m.ID
+			status.RaftTerm = m.RaftTerm
+			leaderIndex = m.RaftIndex
+		}
+	}
+	for i := range status.Members {
+		m := &status.Members[i]
+		if m.Healthy && leaderIndex > m.RaftAppliedIndex {
+			m.RaftLag = leaderIndex - m.RaftAppliedIndex
+		}
+	}
+	sort.Slice(status.Members, func(i, j int) bool {
+		return status.Members[i].Name < status.Members[j].Name
+	})
+
+	alarmsCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if status.Alarms, err = listAlarms(alarmsCtx, cli, mems.Members); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+func memberStatus(ctx context.Context, cli *ClientV3, m *pb.Member, timeout time.Duration) MemberStatus {
+	ms := MemberStatus{
+		ID:         FormatID(m.ID),
+		Name:       m.Name,
+		PeerURLs:   m.PeerURLs,
+		ClientURLs: m.ClientURLs,
+		IsLearner:  m.IsLearner,
+	}
+	if len(m.ClientURLs) == 0 {
+		ms.Errors = []string{"member has not started"}
+		return ms
+	}
+	ms.Endpoint = m.ClientURLs[0]
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	resp, err := cli.Status(ctx, ms.Endpoint)
+	ms.Latency = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		ms.Errors = []string{err.Error()}
+		return ms
+	}
+	ms.Healthy = len(resp.Errors) == 0
+	ms.Errors = resp.Errors
+	ms.IsLeader = resp.Leader == m.ID
+	ms.IsLearner = resp.IsLearner
+	ms.Version = resp.Version
+	ms.RaftTerm = resp.RaftTerm
+	ms.RaftIndex = resp.RaftIndex
+	ms.RaftAppliedIndex = resp.RaftAppliedIndex
+	ms.DbSize = resp.DbSize
+	ms.DbSizeInUse = resp.DbSizeInUse
+	return ms
+}
+
+func newMembers(mems []*pb.Member) []Member {
+	members := make([]Member, 0, len(mems))
+	for _, m := range mems {
+		members = append(members, newMember(m))
+	}
+	return members
+}
+
+func newMember(m *pb.Member) Member {
+	return Member{
+		ID:         FormatID(m.ID),
+		Name:       m.Name,
+		PeerURLs:   m.PeerURLs,
+		ClientURLs: m.ClientURLs,
+		IsLearner:  m.IsLearner,
+	}
+}
+
+// ParseID parses a member or lease ID printed in hexadecimal by FormatID.
+func ParseID(id string) (uint64, error) {
+	return strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(id), "0x"), 16, 64)
+}
+
+// AddMemberV3 adds a member, as a learner when learner is true, and returns
+// it along with the resulting member list.
+func AddMemberV3(ctx context.Context, cli *ClientV3, peerURLs []string, learner bool) (Member, []Member, error) {
+	ctx, cancel := context.WithTimeout(ctx, config.GetConfig().ConnectTimeout)
+	defer cancel()
+	var (
+		resp *clientv3.MemberAddResponse
+		err  error
+	)
+	if learner {
+		resp, err = cli.MemberAddAsLearner(ctx, peerURLs)
+	} else {
+		resp, err = cli.MemberAdd(ctx, peerURLs)
+	}
+	if err != nil {
+		return Member{}, nil, err
+	}
+	return newMember(resp.Member), newMembers(resp.Members), nil
+}
+
+// RemoveMemberV3 removes a member and returns the resulting member list.
+func RemoveMemberV3(ctx context.Context, cli *ClientV3, id uint64) ([]Member, error) {
+	ctx, cancel := context.WithTimeout(ctx, config.GetConfig().ConnectTimeout)
+	defer cancel()
+	resp, err := cli.MemberRemove(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return newMembers(resp.Members), nil
+}
+
+// UpdateMemberV3 changes the peer URLs of a member and returns the resulting
+// member list.
+func UpdateMemberV3(ctx context.Context, cli *ClientV3, id uint64, peerURLs []string) ([]Member, error) {
+	ctx, cancel := context.WithTimeout(ctx, config.GetConfig().ConnectTimeout)
+	defer cancel()
+	resp, err := cli.MemberUpdate(ctx, id, peerURLs)
+	if err != nil {
+		return nil, err
+	}
+	return newMembers(resp.Members), nil
+}
+
+// PromoteMemberV3 promotes a learner to a voting member and returns the
+// resulting member list.
+func PromoteMemberV3(ctx context.Context, cli *ClientV3, id uint64) ([]Member, error) {
+	ctx, cancel := context.WithTimeout(ctx, config.GetConfig().ConnectTimeout)
+	defer cancel()
+	resp, err := cli.MemberPromote(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return newMembers(resp.Members), nil
+}
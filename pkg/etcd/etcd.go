@@ -1,8 +1,13 @@
 package etcd
 
 import (
+	"context"
 	"fmt"
-	"sync"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/trinhdaiphuc/etcdkeeper/config"
 )
 
 type UserInfo struct {
@@ -12,70 +17,94 @@ type UserInfo struct {
 }
 
 var (
-	userMapV2 sync.Map
-	userMapV3 sync.Map
+	poolV2 = newPool("v2", func(user UserInfo) (pooledClient, error) { return newClientV2(user) })
+	poolV3 = newPool("v3", func(user UserInfo) (pooledClient, error) { return newClientV3(user) })
+
+	// dialedTLS is the tlsStamp of the files the pooled v3 clients were
+	// last dialed with.
+	dialedTLS atomic.Value
 )
 
-func GetClientV2(user UserInfo) (*ClientV2, error) {
-	instance, ok := userMapV2.Load(user)
-	if ok {
-		clientV2, _ := instance.(*ClientV2)
-		if user.Username != clientV2.Username || user.Password != clientV2.Password {
-			client, err := newClientV2(user)
-			if err != nil {
-				return nil, err
-			}
-			userMapV2.Store(user.Host, client)
-			return client, nil
+func init() {
+	// Pooled clients keep the TLS settings they were dialed with, and the
+	// certificate files may have been rotated without their paths changing.
+	// Reloads touching neither keep the pools.
+	config.OnReload(func(old, new *config.AppConfig) {
+		dialed, _ := dialedTLS.Load().(string)
+		stamp := tlsStamp(new)
+		if tlsStamp(old) != stamp || (dialed != "" && dialed != stamp) {
+			ResetPools()
 		}
-		return instance.(*ClientV2), nil
+	})
+}
+
+// tlsStamp describes the TLS files of the etcd client by path, size and
+// modification time, empty without TLS.
+func tlsStamp(cfg *config.AppConfig) string {
+	if !cfg.UseTLS {
+		return ""
 	}
-	client, err := newClientV2(user)
+	var b strings.Builder
+	for _, path := range []string{cfg.CaFile, cfg.CertFile, cfg.KeyFile} {
+		fmt.Fprintf(&b, "%s:", path)
+		if info, err := os.Stat(path); path != "" && err == nil {
+			fmt.Fprintf(&b, "%d:%d", info.Size(), info.ModTime().UnixNano())
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// GetClientV2 leases a v2 client for user from the pool. Callers must hand it
+// back with Release once they are done with it.
+func GetClientV2(user UserInfo) (*ClientV2, error) {
+	client, err := poolV2.acquire(user)
 	if err != nil {
 		return nil, err
 	}
-	instance, _ = userMapV2.LoadOrStore(user, client)
-	return instance.(*ClientV2), nil
+	return client.(*ClientV2), nil
 }
 
+// GetClientV3 leases a v3 client for user from the pool. Callers must hand it
+// back with Release once they are done with it.
 func GetClientV3(user UserInfo) (*ClientV3, error) {
-	instance, ok := userMapV3.Load(user)
-	if ok {
-		clientV3, _ := instance.(*ClientV3)
-		if user.Username != clientV3.UserName || user.Password != clientV3.Password {
-			clientV3.Close()
-			client, err := newClientV3(user)
-			fmt.Println("Update client")
-			if err != nil {
-				return nil, err
-			}
-			userMapV2.Store(user, client)
-			return client, nil
-		}
-		return instance.(*ClientV3), nil
-	}
-	client, err := newClientV3(user)
+	client, err := poolV3.acquire(user)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println("New client")
-	instance, _ = userMapV3.LoadOrStore(user, client)
-	return instance.(*ClientV3), nil
+	return client.(*ClientV3), nil
 }
 
-func NodesSort(node map[string]interface{}) {
-	if v, ok := node["nodes"]; ok && v != nil {
-		a := v.([]map[string]interface{})
-		if len(a) != 0 {
-			for i := 0; i < len(a)-1; i++ {
-				NodesSort(a[i])
-				for j := i + 1; j < len(a); j++ {
-					if a[j]["key"].(string) < a[i]["key"].(string) {
-						a[i], a[j] = a[j], a[i]
-					}
-				}
-			}
-			NodesSort(a[len(a)-1])
-		}
+// Ping checks that the v3 cluster at host answers a status request. It uses
+// a pooled client without credentials, etcd serves the status to anyone.
+func Ping(ctx context.Context, host string) error {
+	cli, err := GetClientV3(UserInfo{Host: host})
+	if err != nil {
+		return err
 	}
+	defer cli.Release()
+	return cli.Healthy(ctx)
+}
+
+// PoolStatsV2 returns the state of the v2 client pool.
+func PoolStatsV2() PoolStats {
+	return poolV2.Stats()
+}
+
+// PoolStatsV3 returns the state of the v3 client pool.
+func PoolStatsV3() PoolStats {
+	return poolV3.Stats()
+}
+
+// ClosePools closes every pooled client, it is meant to be called on shutdown.
+func ClosePools() {
+	poolV2.Close()
+	poolV3.Close()
+}
+
+// ResetPools retires every pooled client, the next requests dial new clients
+// with the current settings.
+func ResetPools() {
+	poolV2.Reset()
+	poolV3.Reset()
 }
@@ -0,0 +1,119 @@
+package etcd
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/trinhdaiphuc/etcdkeeper/config"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// leaseLookups bounds the TimeToLive requests ListLeasesV3 runs at once.
+const leaseLookups = 16
+
+// ListLeasesV3 returns every lease in the cluster sorted by ID, along with
+// the keys attached to each of them when withKeys is set. Each lease is
+// looked up with its own CONNECT_TIMEOUT so that clusters with thousands of
+// leases can be listed.
+func ListLeasesV3(ctx context.Context, cli *ClientV3, withKeys bool) ([]Lease, error) {
+	timeout := config.GetConfig().ConnectTimeout
+	listCtx, cancel := context.WithTimeout(ctx, timeout)
+	resp, err := cli.Leases(listCtx)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(resp.Leases, func(i, j int) bool {
+		return resp.Leases[i].ID < resp.Leases[j].ID
+	})
+
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	found := make([]Lease, len(resp.Leases))
+	sem := make(chan struct{}, leaseLookups)
+	var (
+		wg       sync.WaitGroup
+		failOnce sync.Once
+		failed   error
+	)
+	for i, l := range resp.Leases {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, id clientv3.LeaseID) {
+			defer func() { <-sem; wg.Done() }()
+			lookupCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			var err error
+			if found[i], err = timeToLive(lookupCtx, cli, id, withKeys); err != nil {
+				// The first failure is the one reported, the lookups it
+				// cancels fail too.
+				failOnce.Do(func() { failed = err; stop() })
+			}
+		}(i, l.ID)
+	}
+	wg.Wait()
+	if failed != nil {
+		return nil, failed
+	}
+
+	leases := make([]Lease, 0, len(found))
+	for _, lease := range found {
+		// The lease expired between listing and looking it up.
+		if lease.TTL == -1 {
+			continue
+		}
+		leases = append(leases, lease)
+	}
+	return leases, nil
+}
+
+// GetLeaseV3 returns a lease with the keys attached to it.
+func GetLeaseV3(ctx context.Context, cli *ClientV3, id int64) (Lease, error) {
+	ctx, cancel := context.WithTimeout(ctx, config.GetConfig().ConnectTimeout)
+	defer cancel()
+	return timeToLive(ctx, cli, clientv3.LeaseID(id), true)
+}
+
+func timeToLive(ctx context.Context, cli *ClientV3, id clientv3.LeaseID, withKeys bool) (Lease, error) {
+	var opts []clientv3.LeaseOption
+	if withKeys {
+		opts = append(opts, clientv3.WithAttachedKeys())
+	}
+	resp, err := cli.TimeToLive(ctx, id, opts...)
+	if err != nil {
+		return Lease{}, err
+	}
+	lease := Lease{
+		ID:         FormatID(uint64(id)),
+		GrantedTTL: resp.GrantedTTL,
+		TTL:        resp.TTL,
+	}
+	if withKeys {
+		lease.Keys = make([]string, 0, len(resp.Keys))
+		for _, k := range resp.Keys {
+			lease.Keys = append(lease.Keys, string(k))
+		}
+		sort.Strings(lease.Keys)
+	}
+	return lease, nil
+}
+
+// RevokeLeaseV3 revokes a lease, deleting every key attached to it.
+func RevokeLeaseV3(ctx context.Context, cli *ClientV3, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, config.GetConfig().ConnectTimeout)
+	defer cancel()
+	_, err := cli.Revoke(ctx, clientv3.LeaseID(id))
+	return err
+}
+
+// KeepAliveOnceV3 renews a lease once and returns its new TTL.
+func KeepAliveOnceV3(ctx context.Context, cli *ClientV3, id int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, config.GetConfig().ConnectTimeout)
+	defer cancel()
+	resp, err := cli.KeepAliveOnce(ctx, clientv3.LeaseID(id))
+	if err != nil {
+		return 0, err
+	}
+	return resp.TTL, nil
+}
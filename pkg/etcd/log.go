@@ -0,0 +1,194 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/logging"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/client/v2"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+)
+
+// routineKey marks the contexts of the calls etcdkeeper makes on its own,
+// such as the health checks of the pools, which are logged at debug level.
+type routineKey struct{}
+
+func withRoutine(ctx context.Context) context.Context {
+	return context.WithValue(ctx, routineKey{}, true)
+}
+
+// logOp logs an etcd call with the request ID of ctx. Only the key is
+// logged, never values or credentials.
+func logOp(ctx context.Context, user UserInfo, op, key string, start time.Time, err error) {
+	logger := logging.FromContext(ctx)
+	level := zapcore.InfoLevel
+	switch {
+	case ctx.Value(routineKey{}) != nil:
+		level = zapcore.DebugLevel
+	case err != nil:
+		level = zapcore.WarnLevel
+	}
+	if ce := logger.Check(level, "etcd"); ce != nil {
+		fields := []zap.Field{
+			zap.String("cluster", user.Host),
+			zap.String("user", user.Username),
+			zap.String("op", op),
+			zap.Duration("duration", time.Since(start)),
+		}
+		if key != "" {
+			fields = append(fields, zap.String("key", key))
+		}
+		if err != nil {
+			fields = append(fields, zap.Error(err))
+		}
+		ce.Write(fields...)
+	}
+}
+
+// unaryLogger returns a gRPC interceptor logging the v3 calls of user.
+func unaryLogger(user UserInfo) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		logOp(ctx, user, method[strings.LastIndex(method, ".")+1:], requestKey(req), start, err)
+		return err
+	}
+}
+
+// Watch is the Watch of clientv3, logged once the watch ends. Responses are
+// dropped after ctx is done, like the ones of clientv3.
+func (c *ClientV3) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	start := time.Now()
+	wch := c.Client.Watch(ctx, key, opts...)
+	out := make(chan clientv3.WatchResponse)
+	go func() {
+		defer close(out)
+		var err error
+		for resp := range wch {
+			if resp.Err() != nil {
+				err = resp.Err()
+			}
+			select {
+			case out <- resp:
+			case <-ctx.Done():
+			}
+		}
+		logOp(ctx, UserInfo{Host: c.Host, Username: c.UserName}, "Watch/Watch", key, start, err)
+	}()
+	return out
+}
+
+// requestKey returns the key a v3 request is about, the first one for a
+// transaction.
+func requestKey(req interface{}) string {
+	switch r := req.(type) {
+	case *pb.RangeRequest:
+		return string(r.Key)
+	case *pb.PutRequest:
+		return string(r.Key)
+	case *pb.DeleteRangeRequest:
+		return string(r.Key)
+	case *pb.TxnRequest:
+		if len(r.Compare) > 0 {
+			return string(r.Compare[0].Key)
+		}
+		for _, ops := range [][]*pb.RequestOp{r.Success, r.Failure} {
+			for _, op := range ops {
+				switch o := op.Request.(type) {
+				case *pb.RequestOp_RequestRange:
+					return string(o.RequestRange.Key)
+				case *pb.RequestOp_RequestPut:
+					return string(o.RequestPut.Key)
+				case *pb.RequestOp_RequestDeleteRange:
+					return string(o.RequestDeleteRange.Key)
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// NewKeysAPI returns the v2 keys API of cli, logging every call with the
+// request ID of its context. The v2 client does not hand the context over to
+// its transport, so these calls are logged here rather than by logTransport.
+func NewKeysAPI(cli *ClientV2) client.KeysAPI {
+	return loggedKeysAPI{
+		KeysAPI: client.NewKeysAPI(cli),
+		user:    UserInfo{Host: cli.Host, Username: cli.Username},
+	}
+}
+
+type loggedKeysAPI struct {
+	client.KeysAPI
+	user UserInfo
+}
+
+func (k loggedKeysAPI) Get(ctx context.Context, key string, opts *client.GetOptions) (*client.Response, error) {
+	start := time.Now()
+	resp, err := k.KeysAPI.Get(ctx, key, opts)
+	logOp(ctx, k.user, "GET /v2/keys", key, start, err)
+	return resp, err
+}
+
+func (k loggedKeysAPI) Set(ctx context.Context, key, value string, opts *client.SetOptions) (*client.Response, error) {
+	start := time.Now()
+	resp, err := k.KeysAPI.Set(ctx, key, value, opts)
+	logOp(ctx, k.user, "PUT /v2/keys", key, start, err)
+	return resp, err
+}
+
+func (k loggedKeysAPI) Delete(ctx context.Context, key string, opts *client.DeleteOptions) (*client.Response, error) {
+	start := time.Now()
+	resp, err := k.KeysAPI.Delete(ctx, key, opts)
+	logOp(ctx, k.user, "DELETE /v2/keys", key, start, err)
+	return resp, err
+}
+
+func (k loggedKeysAPI) Create(ctx context.Context, key, value string) (*client.Response, error) {
+	start := time.Now()
+	resp, err := k.KeysAPI.Create(ctx, key, value)
+	logOp(ctx, k.user, "PUT /v2/keys", key, start, err)
+	return resp, err
+}
+
+func (k loggedKeysAPI) CreateInOrder(ctx context.Context, dir, value string, opts *client.CreateInOrderOptions) (*client.Response, error) {
+	start := time.Now()
+	resp, err := k.KeysAPI.CreateInOrder(ctx, dir, value, opts)
+	logOp(ctx, k.user, "POST /v2/keys", dir, start, err)
+	return resp, err
+}
+
+func (k loggedKeysAPI) Update(ctx context.Context, key, value string) (*client.Response, error) {
+	start := time.Now()
+	resp, err := k.KeysAPI.Update(ctx, key, value)
+	logOp(ctx, k.user, "PUT /v2/keys", key, start, err)
+	return resp, err
+}
+
+// logTransport logs the v2 calls of user other than the keys API ones, such
+// as the version, members and auth requests. They are not tied to a request
+// ID.
+type logTransport struct {
+	client.CancelableTransport
+	user UserInfo
+}
+
+func (t logTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.CancelableTransport.RoundTrip(req)
+	if !strings.HasPrefix(req.URL.Path, "/v2/keys") {
+		logErr := err
+		if err == nil && resp.StatusCode >= http.StatusInternalServerError {
+			logErr = errors.New(resp.Status)
+		}
+		logOp(req.Context(), t.user, req.Method+" "+req.URL.Path, "", start, logErr)
+	}
+	return resp, err
+}
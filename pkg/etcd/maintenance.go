@@ -0,0 +1,128 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/trinhdaiphuc/etcdkeeper/config"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// CompactV3 compacts the keyspace up to revision. With physical set it waits
+// until the compaction has been applied to the backend database. It returns
+// the current revision of the store.
+func CompactV3(ctx context.Context, cli *ClientV3, revision int64, physical bool) (int64, error) {
+	var opts []clientv3.CompactOption
+	if physical {
+		opts = append(opts, clientv3.WithCompactPhysical())
+	}
+	resp, err := cli.Compact(ctx, revision, opts...)
+	if err != nil {
+		return 0, err
+	}
+	return resp.Header.Revision, nil
+}
+
+// DefragmentV3 defragments the backend database of a single member and
+// returns its status afterwards. It can take a while on large databases, ctx
+// bounds how long to wait.
+func DefragmentV3(ctx context.Context, cli *ClientV3, memberID uint64) (MemberStatus, error) {
+	member, err := findMember(ctx, cli, memberID)
+	if err != nil {
+		return MemberStatus{}, err
+	}
+	if _, err = cli.Defragment(ctx, member.ClientURLs[0]); err != nil {
+		return MemberStatus{}, err
+	}
+	return memberStatus(ctx, cli, member, config.GetConfig().ConnectTimeout), nil
+}
+
+// findMember returns the started member with the given ID.
+func findMember(ctx context.Context, cli *ClientV3, memberID uint64) (*pb.Member, error) {
+	ctx, cancel := context.WithTimeout(ctx, config.GetConfig().ConnectTimeout)
+	defer cancel()
+	mems, err := cli.MemberList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range mems.Members {
+		if m.ID != memberID {
+			continue
+		}
+		if len(m.ClientURLs) == 0 {
+			return nil, fmt.Errorf("member %s has not started", FormatID(memberID))
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("member %s not found", FormatID(memberID))
+}
+
+// ListAlarmsV3 returns the alarms currently raised in the cluster.
+func ListAlarmsV3(ctx context.Context, cli *ClientV3) ([]Alarm, error) {
+	ctx, cancel := context.WithTimeout(ctx, config.GetConfig().ConnectTimeout)
+	defer cancel()
+	mems, err := cli.MemberList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return listAlarms(ctx, cli, mems.Members)
+}
+
+func listAlarms(ctx context.Context, cli *ClientV3, members []*pb.Member) ([]Alarm, error) {
+	resp, err := cli.AlarmList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[uint64]string, len(members))
+	for _, m := range members {
+		names[m.ID] = m.Name
+	}
+	alarms := make([]Alarm, 0, len(resp.Alarms))
+	for _, a := range resp.Alarms {
+		alarms = append(alarms, Alarm{
+			MemberID:   FormatID(a.MemberID),
+			MemberName: names[a.MemberID],
+			Alarm:      a.Alarm.String(),
+		})
+	}
+	return alarms, nil
+}
+
+// ParseAlarm parses an alarm name such as NOSPACE or CORRUPT. An empty name
+// is AlarmType_NONE, which disarms every alarm.
+func ParseAlarm(name string) (pb.AlarmType, error) {
+	if name == "" {
+		return pb.AlarmType_NONE, nil
+	}
+	alarm, ok := pb.AlarmType_value[strings.ToUpper(name)]
+	if !ok {
+		return pb.AlarmType_NONE, fmt.Errorf("unknown alarm %s", name)
+	}
+	return pb.AlarmType(alarm), nil
+}
+
+// DisarmAlarmV3 disarms alarm on member. A zero memberID together with
+// AlarmType_NONE disarms every active alarm. It returns the alarms that were
+// disarmed.
+func DisarmAlarmV3(ctx context.Context, cli *ClientV3, memberID uint64, alarm pb.AlarmType) ([]Alarm, error) {
+	ctx, cancel := context.WithTimeout(ctx, config.GetConfig().ConnectTimeout)
+	defer cancel()
+	resp, err := cli.AlarmDisarm(ctx, &clientv3.AlarmMember{MemberID: memberID, Alarm: alarm})
+	if err != nil {
+		return nil, err
+	}
+	alarms := make([]Alarm, 0, len(resp.Alarms))
+	for _, a := range resp.Alarms {
+		alarms = append(alarms, Alarm{MemberID: FormatID(a.MemberID), Alarm: a.Alarm.String()})
+	}
+	return alarms, nil
+}
+
+// SnapshotV3 streams a snapshot of the backend database from the member the
+// client is connected to. The caller must close the returned reader.
+func SnapshotV3(ctx context.Context, cli *ClientV3) (io.ReadCloser, error) {
+	return cli.Snapshot(ctx)
+}
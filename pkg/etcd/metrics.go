@@ -0,0 +1,124 @@
+package etcd
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/trinhdaiphuc/etcdkeeper/config"
+	"go.etcd.io/etcd/client/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Metrics of the etcd calls, labelled with the cluster, see clusterLabel, and
+// the operation: the gRPC method of v3 calls, such as KV/Range, and the HTTP
+// method and path of v2 calls, such as GET /v2/keys.
+var (
+	opDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "etcdkeeper_etcd_operation_duration_seconds",
+		Help:    "Duration of the etcd operations.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"cluster", "op"})
+	opErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "etcdkeeper_etcd_operation_errors_total",
+		Help: "Failed etcd operations by gRPC code, or HTTP status for v2.",
+	}, []string{"cluster", "op", "code"})
+)
+
+func init() {
+	for _, p := range []*Pool{poolV2, poolV3} {
+		registerPool(p)
+	}
+}
+
+// registerPool exports the state and the counters of a client pool.
+func registerPool(p *Pool) {
+	labels := prometheus.Labels{"version": p.name}
+	gauge := func(name, help string, value func(PoolStats) int) {
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help, ConstLabels: labels},
+			func() float64 { return float64(value(p.Stats())) })
+	}
+	counter := func(name, help string, value func(PoolStats) uint64) {
+		promauto.NewCounterFunc(prometheus.CounterOpts{Name: name, Help: help, ConstLabels: labels},
+			func() float64 { return float64(value(p.Stats())) })
+	}
+	gauge("etcdkeeper_pool_clients", "Pooled etcd clients.", func(s PoolStats) int { return s.Clients })
+	gauge("etcdkeeper_pool_clients_in_use", "Pooled etcd clients leased by a request.", func(s PoolStats) int { return s.InUse })
+	gauge("etcdkeeper_pool_clients_retired", "Replaced etcd clients waiting for their last lease to be released.", func(s PoolStats) int { return s.Retired })
+	counter("etcdkeeper_pool_hits_total", "Leases served by a pooled client.", func(s PoolStats) uint64 { return s.Hits })
+	counter("etcdkeeper_pool_misses_total", "Leases that had to dial a client.", func(s PoolStats) uint64 { return s.Misses })
+	counter("etcdkeeper_pool_evictions_total", "Clients closed after POOL_IDLE_TTL.", func(s PoolStats) uint64 { return s.Evictions })
+	counter("etcdkeeper_pool_unhealthy_total", "Clients closed after a failed health check.", func(s PoolStats) uint64 { return s.Unhealthy })
+}
+
+// otherCluster labels the calls to the clusters clusterLabel does not know.
+const otherCluster = "other"
+
+// clusterLabel returns the cluster label of the calls to host: host when it
+// is listed in METRICS_CLUSTERS or READY_CLUSTERS, with or without its
+// scheme, otherCluster otherwise. Hosts are typed in by the users, a label
+// each would let anyone add series.
+func clusterLabel(host string) string {
+	cfg := config.GetConfig()
+	endpoint := trimScheme(host)
+	for _, list := range []string{cfg.MetricsClusters, cfg.ReadyClusters} {
+		for _, known := range strings.Split(list, ",") {
+			if known = trimScheme(strings.TrimSpace(known)); known != "" && known == endpoint {
+				return host
+			}
+		}
+	}
+	return otherCluster
+}
+
+func trimScheme(host string) string {
+	if i := strings.Index(host, "://"); i >= 0 {
+		return host[i+3:]
+	}
+	return host
+}
+
+// unaryMetrics returns a gRPC interceptor recording the v3 calls to cluster.
+func unaryMetrics(cluster string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		op := method[strings.LastIndex(method, ".")+1:]
+		label := clusterLabel(cluster)
+		opDuration.WithLabelValues(label, op).Observe(time.Since(start).Seconds())
+		if err != nil {
+			opErrors.WithLabelValues(label, op, status.Code(err).String()).Inc()
+		}
+		return err
+	}
+}
+
+// metricsTransport records the v2 calls to cluster.
+type metricsTransport struct {
+	client.CancelableTransport
+	cluster string
+}
+
+func (t metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.CancelableTransport.RoundTrip(req)
+	// Keep the API path only, the rest of v2 key paths is the key.
+	path := req.URL.Path
+	if parts := strings.SplitN(path, "/", 4); len(parts) == 4 {
+		path = strings.Join(parts[:3], "/")
+	}
+	op := req.Method + " " + path
+	label := clusterLabel(t.cluster)
+	opDuration.WithLabelValues(label, op).Observe(time.Since(start).Seconds())
+	switch {
+	case err != nil:
+		opErrors.WithLabelValues(label, op, "error").Inc()
+	case resp.StatusCode >= http.StatusInternalServerError:
+		opErrors.WithLabelValues(label, op, http.StatusText(resp.StatusCode)).Inc()
+	}
+	return resp, err
+}
@@ -0,0 +1,29 @@
+package etcd
+
+import (
+	"testing"
+
+	"github.com/trinhdaiphuc/etcdkeeper/config"
+)
+
+func TestClusterLabel(t *testing.T) {
+	args := []string{"-metrics-clusters", "a:2379, https://b:2379", "-ready-clusters", "c:2379"}
+	if _, err := config.Load(config.NewFlagSet("test"), args); err != nil {
+		t.Fatal(err)
+	}
+	for host, want := range map[string]string{
+		"a:2379":                "a:2379",
+		"http://a:2379":         "http://a:2379",
+		"http://b:2379":         "http://b:2379",
+		"http://c:2379":         "http://c:2379",
+		"http://d:2379":         otherCluster,
+		"http://a:2379,b:2379":  otherCluster,
+		"":                      otherCluster,
+		"http://":               otherCluster,
+		"http://attacker:12345": otherCluster,
+	} {
+		if got := clusterLabel(host); got != want {
+			t.Errorf("clusterLabel(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package etcd
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/trinhdaiphuc/etcdkeeper/config"
+	"go.uber.org/zap"
+)
+
+// pooledClient is implemented by the etcd clients kept in a Pool.
+type pooledClient interface {
+	Close() error
+	Healthy(ctx context.Context) error
+}
+
+type dialFunc func(user UserInfo) (pooledClient, error)
+
+// poolKey identifies a pooled client. The password is deliberately not part
+// of the key: a login with new credentials replaces the existing client.
+type poolKey struct {
+	host     string
+	username string
+}
+
+type poolEntry struct {
+	key      poolKey
+	password string
+	client   pooledClient
+	refs     int
+	lastUsed time.Time
+	retired  bool
+}
+
+// PoolStats is a snapshot of a Pool's state and counters.
+type PoolStats struct {
+	Clients   int    `json:"clients"`
+	InUse     int    `json:"inUse"`
+	Idle      int    `json:"idle"`
+	Retired   int    `json:"retired"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Unhealthy uint64 `json:"unhealthy"`
+}
+
+// Pool caches etcd clients per host and user. Clients are leased with acquire
+// and handed back with release; a client is only closed once nobody holds it.
+// Idle clients are evicted after POOL_IDLE_TTL and every client is
+// health-checked each POOL_HEALTH_INTERVAL.
+type Pool struct {
+	name    string
+	dial    dialFunc
+	once    sync.Once
+	stop    chan struct{}
+	done    chan struct{}
+	mu      sync.Mutex
+	entries map[poolKey]*poolEntry
+	leased  map[pooledClient]*poolEntry
+	stats   PoolStats
+}
+
+func newPool(name string, dial dialFunc) *Pool {
+	return &Pool{
+		name:    name,
+		dial:    dial,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		entries: make(map[poolKey]*poolEntry),
+		leased:  make(map[pooledClient]*poolEntry),
+	}
+}
+
+func (p *Pool) acquire(user UserInfo) (pooledClient, error) {
+	p.once.Do(p.start)
+	key := poolKey{host: user.Host, username: user.Username}
+
+	p.mu.Lock()
+	if c, ok := p.lease(key, user.Password); ok {
+		p.stats.Hits++
+		p.mu.Unlock()
+		return c, nil
+	}
+	p.stats.Misses++
+	p.mu.Unlock()
+
+	// Dial without holding the lock, connecting may block up to CONNECT_TIMEOUT.
+	client, err := p.dial(user)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// Another request may have dialed the same client in the meantime.
+	if c, ok := p.lease(key, user.Password); ok {
+		go client.Close()
+		return c, nil
+	}
+	if old, ok := p.entries[key]; ok {
+		p.retire(old)
+	}
+	entry := &poolEntry{
+		key:      key,
+		password: user.Password,
+		client:   client,
+		refs:     1,
+		lastUsed: time.Now(),
+	}
+	p.entries[key] = entry
+	p.leased[client] = entry
+	zap.L().Info("etcd pool: new client", zap.String("pool", p.name), zap.String("cluster", user.Host), zap.String("user", user.Username))
+	return client, nil
+}
+
+// lease returns the live client for key when its password still matches.
+// Must be called with p.mu held.
+func (p *Pool) lease(key poolKey, password string) (pooledClient, bool) {
+	entry, ok := p.entries[key]
+	if !ok || entry.password != password {
+		return nil, false
+	}
+	entry.refs++
+	entry.lastUsed = time.Now()
+	return entry.client, true
+}
+
+func (p *Pool) release(client pooledClient) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry, ok := p.leased[client]
+	if !ok {
+		return
+	}
+	if entry.refs > 0 {
+		entry.refs--
+	}
+	entry.lastUsed = time.Now()
+	if entry.retired && entry.refs == 0 {
+		p.closeEntry(entry)
+	}
+}
+
+// retire removes entry from the pool so no new leases are handed out. The
+// client is closed as soon as its last lease is released.
+// Must be called with p.mu held.
+func (p *Pool) retire(entry *poolEntry) {
+	if p.entries[entry.key] == entry {
+		delete(p.entries, entry.key)
+	}
+	entry.retired = true
+	if entry.refs == 0 {
+		p.closeEntry(entry)
+	}
+}
+
+// Must be called with p.mu held.
+func (p *Pool) closeEntry(entry *poolEntry) {
+	delete(p.leased, entry.client)
+	go func(c pooledClient) {
+		if err := c.Close(); err != nil {
+			zap.L().Warn("etcd pool: close client", zap.String("pool", p.name), zap.Error(err))
+		}
+	}(entry.client)
+}
+
+func (p *Pool) start() {
+	cfg := config.GetConfig()
+	go p.run(cfg.PoolIdleTTL, cfg.PoolHealthInterval)
+}
+
+func (p *Pool) run(idleTTL, healthInterval time.Duration) {
+	defer close(p.done)
+	evictTicker := time.NewTicker(evictInterval(idleTTL))
+	defer evictTicker.Stop()
+	healthTicker := time.NewTicker(healthInterval)
+	defer healthTicker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-evictTicker.C:
+			p.evictIdle(idleTTL)
+		case <-healthTicker.C:
+			p.checkHealth()
+		}
+	}
+}
+
+func evictInterval(idleTTL time.Duration) time.Duration {
+	if interval := idleTTL / 2; interval >= time.Second {
+		return interval
+	}
+	return time.Second
+}
+
+func (p *Pool) evictIdle(idleTTL time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for _, entry := range p.entries {
+		if entry.refs == 0 && now.Sub(entry.lastUsed) > idleTTL {
+			p.stats.Evictions++
+			p.retire(entry)
+		}
+	}
+}
+
+func (p *Pool) checkHealth() {
+	p.mu.Lock()
+	entries := make([]*poolEntry, 0, len(p.entries))
+	for _, entry := range p.entries {
+		entries = append(entries, entry)
+	}
+	p.mu.Unlock()
+
+	// Every tick is logged at debug level, along with the calls it makes,
+	// only the clients found unhealthy and retired are logged above it.
+	unhealthy := 0
+	for _, entry := range entries {
+		ctx, cancel := context.WithTimeout(withRoutine(context.Background()), config.GetConfig().ConnectTimeout)
+		err := entry.client.Healthy(ctx)
+		cancel()
+		if err == nil {
+			continue
+		}
+		p.mu.Lock()
+		// The entry may have been evicted or reset during the check, its
+		// client is closed or closing then and must not be retired again.
+		if entry.retired {
+			p.mu.Unlock()
+			continue
+		}
+		unhealthy++
+		p.stats.Unhealthy++
+		p.retire(entry)
+		p.mu.Unlock()
+		zap.L().Warn("etcd pool: unhealthy client", zap.String("pool", p.name), zap.String("cluster", entry.key.host),
+			zap.String("user", entry.key.username), zap.Error(err))
+	}
+	zap.L().Debug("etcd pool: health check", zap.String("pool", p.name), zap.Int("clients", len(entries)),
+		zap.Int("unhealthy", unhealthy))
+}
+
+// Reset retires every client so that the next leases dial new ones. Clients
+// in use are closed once released.
+func (p *Pool) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, entry := range p.entries {
+		p.retire(entry)
+	}
+}
+
+// Stats returns a snapshot of the pool.
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.stats
+	stats.Clients = len(p.entries)
+	for _, entry := range p.entries {
+		if entry.refs > 0 {
+			stats.InUse++
+		} else {
+			stats.Idle++
+		}
+	}
+	stats.Retired = len(p.leased) - len(p.entries)
+	return stats
+}
+
+// Close stops the background checks and closes every client, leased or not.
+func (p *Pool) Close() {
+	p.once.Do(func() { close(p.done) })
+	select {
+	case <-p.stop:
+	default:
+		close(p.stop)
+	}
+	<-p.done
+
+	p.mu.Lock()
+	clients := make([]pooledClient, 0, len(p.leased))
+	for client, entry := range p.leased {
+		delete(p.entries, entry.key)
+		delete(p.leased, client)
+		clients = append(clients, client)
+	}
+	p.mu.Unlock()
+
+	for _, client := range clients {
+		if err := client.Close(); err != nil {
+			zap.L().Warn("etcd pool: close client", zap.String("pool", p.name), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// fakeClient is a pooledClient failing its health checks once closed.
+type fakeClient struct {
+	mu      sync.Mutex
+	closes  int
+	healthy func()
+}
+
+func (c *fakeClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closes++
+	return nil
+}
+
+func (c *fakeClient) Healthy(ctx context.Context) error {
+	if c.healthy != nil {
+		c.healthy()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closes > 0 {
+		return errors.New("closed")
+	}
+	return nil
+}
+
+func (c *fakeClient) closed() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closes
+}
+
+func TestCheckHealthSkipsRetired(t *testing.T) {
+	var p *Pool
+	client := &fakeClient{}
+	// The pool is reset while the client is being checked.
+	client.healthy = func() {
+		p.Reset()
+		client.Close()
+	}
+	p = newPool("test", func(UserInfo) (pooledClient, error) { return client, nil })
+	p.once.Do(func() {})
+	c, err := p.acquire(UserInfo{Host: "h", Username: "u"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.release(c)
+
+	p.checkHealth()
+	if stats := p.Stats(); stats.Unhealthy != 0 || stats.Clients != 0 {
+		t.Errorf("stats = %+v, want no client and none unhealthy", stats)
+	}
+}
+
+func TestCheckHealthRetiresUnhealthy(t *testing.T) {
+	client := &fakeClient{}
+	p := newPool("test", func(UserInfo) (pooledClient, error) { return client, nil })
+	p.once.Do(func() {})
+	c, err := p.acquire(UserInfo{Host: "h", Username: "u"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	p.checkHealth()
+	if stats := p.Stats(); stats.Unhealthy != 1 || stats.Clients != 0 {
+		t.Errorf("stats = %+v, want the client retired as unhealthy", stats)
+	}
+	// Leased clients are closed on release only.
+	if n := client.closed(); n != 1 {
+		t.Errorf("client closed %d times before release, want 1", n)
+	}
+	p.release(c)
+}
@@ -0,0 +1,285 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/keymatch"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	searchPageSize     = 1000
+	maxSnippets        = 3
+	snippetContextSize = 40
+)
+
+// KeyMatcher matches keys. keymatch.Pattern satisfies it, RegexpMatcher
+// adapts a regular expression.
+type KeyMatcher interface {
+	Match(key string) bool
+}
+
+// RegexpMatcher adapts a regular expression to KeyMatcher.
+type RegexpMatcher struct {
+	*regexp.Regexp
+}
+
+func (m RegexpMatcher) Match(key string) bool {
+	return m.MatchString(key)
+}
+
+// foldMatcher matches lower cased keys against a lower cased glob pattern.
+type foldMatcher struct {
+	*keymatch.Pattern
+}
+
+func (m foldMatcher) Match(key string) bool {
+	return m.Pattern.Match(strings.ToLower(key))
+}
+
+// SearchQuery describes a key search.
+type SearchQuery struct {
+	// Ranges are the key ranges to scan, see SearchRanges.
+	Ranges []KeyRange
+	// Key filters keys, every key matches when nil.
+	Key KeyMatcher
+	// Value filters values, values are not read at all when nil.
+	Value *regexp.Regexp
+	// Limit is the maximum number of results.
+	Limit int
+}
+
+// ParseSearchQuery builds the filters of a SearchQuery.
+//
+//	pattern     glob (default) or regular expression matched against keys
+//	mode        "glob" or "regex", how pattern is interpreted
+//	value       substring (default) or regular expression searched in values
+//	valueMode   "substring" or "regex", how value is interpreted
+//	ignoreCase  match pattern and value case-insensitively
+func ParseSearchQuery(pattern, mode, value, valueMode string, ignoreCase bool, separator string) (SearchQuery, error) {
+	var q SearchQuery
+	if pattern != "" {
+		switch mode {
+		case "", "glob":
+			if ignoreCase {
+				pattern, separator = strings.ToLower(pattern), strings.ToLower(separator)
+			}
+			p, err := keymatch.Compile(pattern, separator)
+			if err != nil {
+				return q, errors.New("invalid pattern: " + err.Error())
+			}
+			q.Key = p
+			if ignoreCase {
+				q.Key = foldMatcher{p}
+			}
+		case "regex":
+			re, err := compileSearch(pattern, ignoreCase)
+			if err != nil {
+				return q, errors.New("invalid pattern: " + err.Error())
+			}
+			q.Key = RegexpMatcher{Regexp: re}
+		default:
+			return q, errors.New("mode must be glob or regex")
+		}
+	}
+
+	if value != "" {
+		switch valueMode {
+		case "", "substring":
+			value = regexp.QuoteMeta(value)
+		case "regex":
+		default:
+			return q, errors.New("valueMode must be substring or regex")
+		}
+		re, err := compileSearch(value, ignoreCase)
+		if err != nil {
+			return q, errors.New("invalid value: " + err.Error())
+		}
+		q.Value = re
+	}
+	return q, nil
+}
+
+func compileSearch(expr string, ignoreCase bool) (*regexp.Regexp, error) {
+	if ignoreCase {
+		expr = "(?i)" + expr
+	}
+	return regexp.Compile(expr)
+}
+
+// KeyRange is a key prefix, or a single key when Prefix is false.
+type KeyRange struct {
+	Key    string
+	Prefix bool
+}
+
+// SearchRanges narrows the permissions returned by GetPermissionPrefix down to
+// the keys under prefix. The separator alone stands for the whole keyspace.
+func SearchRanges(permissions [][]string, prefix, separator string) []KeyRange {
+	if prefix == separator {
+		prefix = ""
+	}
+	var (
+		ranges []KeyRange
+		seen   = make(map[KeyRange]bool)
+	)
+	add := func(r KeyRange) {
+		if !seen[r] {
+			seen[r] = true
+			ranges = append(ranges, r)
+		}
+	}
+	for _, p := range permissions {
+		key, isPrefix := p[0], p[1] != ""
+		if key == separator && isPrefix {
+			key = ""
+		}
+		switch {
+		case !isPrefix:
+			if strings.HasPrefix(key, prefix) {
+				add(KeyRange{Key: key})
+			}
+		case strings.HasPrefix(prefix, key):
+			add(KeyRange{Key: prefix, Prefix: true})
+		case strings.HasPrefix(key, prefix):
+			add(KeyRange{Key: key, Prefix: true})
+		}
+	}
+	return ranges
+}
+
+// SearchV3 scans the query ranges page by page with keys-only reads and
+// only fetches the values of keys whose name matched when a value filter
+// is set. Every page is read at the revision of the first one so the search
+// sees a consistent keyspace.
+func SearchV3(ctx context.Context, cli *ClientV3, q SearchQuery) (*SearchResponse, error) {
+	resp := &SearchResponse{Results: make([]SearchResult, 0)}
+	for _, r := range q.Ranges {
+		start, end := r.Key, ""
+		switch {
+		case !r.Prefix:
+			end = r.Key + "\x00"
+		case r.Key == "":
+			start, end = "\x00", "\x00"
+		default:
+			end = clientv3.GetPrefixRangeEnd(r.Key)
+		}
+
+		for {
+			opts := []clientv3.OpOption{
+				clientv3.WithRange(end),
+				clientv3.WithKeysOnly(),
+				clientv3.WithLimit(searchPageSize),
+				clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend),
+			}
+			if resp.Revision != 0 {
+				opts = append(opts, clientv3.WithRev(resp.Revision))
+			}
+			page, err := cli.Get(ctx, start, opts...)
+			if err != nil {
+				return nil, err
+			}
+			if resp.Revision == 0 {
+				resp.Revision = page.Header.Revision
+			}
+			resp.Scanned += int64(len(page.Kvs))
+
+			var candidates []string
+			for _, kv := range page.Kvs {
+				if q.Key == nil || q.Key.Match(string(kv.Key)) {
+					candidates = append(candidates, string(kv.Key))
+				}
+			}
+			if err = searchValues(ctx, cli, q, resp, candidates); err != nil {
+				return nil, err
+			}
+			if resp.Truncated || !page.More || len(page.Kvs) == 0 {
+				break
+			}
+			start = string(page.Kvs[len(page.Kvs)-1].Key) + "\x00"
+		}
+		if resp.Truncated {
+			break
+		}
+	}
+	return resp, nil
+}
+
+// searchValues adds the candidates of a page to the results, reading their
+// values first when the query filters on them.
+func searchValues(ctx context.Context, cli *ClientV3, q SearchQuery, resp *SearchResponse, candidates []string) error {
+	if len(candidates) == 0 {
+		return nil
+	}
+	if q.Value == nil {
+		for _, key := range candidates {
+			if !addResult(q, resp, SearchResult{Key: key}) {
+				return nil
+			}
+		}
+		return nil
+	}
+
+	wanted := make(map[string]bool, len(candidates))
+	for _, key := range candidates {
+		wanted[key] = true
+	}
+	values, err := cli.Get(ctx, candidates[0],
+		clientv3.WithRange(candidates[len(candidates)-1]+"\x00"),
+		clientv3.WithRev(resp.Revision),
+		clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return err
+	}
+	for _, kv := range values.Kvs {
+		if !wanted[string(kv.Key)] {
+			continue
+		}
+		matches := q.Value.FindAllIndex(kv.Value, maxSnippets)
+		if len(matches) == 0 {
+			continue
+		}
+		result := SearchResult{Key: string(kv.Key), Snippets: make([]Snippet, 0, len(matches))}
+		for _, m := range matches {
+			result.Snippets = append(result.Snippets, snippet(kv.Value, m[0], m[1]))
+		}
+		if !addResult(q, resp, result) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// addResult appends result and reports whether the search may go on.
+func addResult(q SearchQuery, resp *SearchResponse, result SearchResult) bool {
+	if q.Limit > 0 && len(resp.Results) >= q.Limit {
+		resp.Truncated = true
+		return false
+	}
+	resp.Results = append(resp.Results, result)
+	return true
+}
+
+// snippet cuts the value around value[start:end], keeping whole UTF-8
+// characters.
+func snippet(value []byte, start, end int) Snippet {
+	from := start - snippetContextSize
+	if from < 0 {
+		from = 0
+	}
+	for from > 0 && !utf8.RuneStart(value[from]) {
+		from--
+	}
+	to := end + snippetContextSize
+	if to > len(value) {
+		to = len(value)
+	}
+	for to < len(value) && !utf8.RuneStart(value[to]) {
+		to++
+	}
+	return Snippet{Text: string(value[from:to]), Start: start - from, End: end - from}
+}
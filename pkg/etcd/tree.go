@@ -0,0 +1,118 @@
+package etcd
+
+import (
+	"sort"
+	"strings"
+)
+
+// Tree assembles the nested nodes rendered by the UI from a flat list of
+// keys. Keys are split on the separator and stored in a trie, so adding a key
+// costs O(segments) no matter how many keys the tree already holds, and the
+// whole tree is built in a single pass.
+type Tree struct {
+	separator string
+	root      *treeNode
+	found     bool
+}
+
+type treeNode struct {
+	key      string
+	fields   map[string]interface{}
+	children map[string]*treeNode
+}
+
+// NewTree returns an empty tree rooted at root.
+func NewTree(root, separator string) *Tree {
+	return &Tree{separator: separator, root: newTreeNode(root)}
+}
+
+func newTreeNode(key string) *treeNode {
+	return &treeNode{key: key, fields: map[string]interface{}{"key": key}}
+}
+
+// Add inserts key with the given node fields, creating a node for every
+// missing parent between the root and the key. Keys outside the root
+// are ignored and the fields of a key added twice are merged.
+func (t *Tree) Add(key string, fields map[string]interface{}) {
+	var rest string
+	switch {
+	case key == t.root.key:
+		t.found = true
+		t.root.merge(fields)
+		return
+	case t.root.key == t.separator:
+		rest = strings.TrimPrefix(key, t.separator)
+	case strings.HasPrefix(key, t.root.key+t.separator):
+		rest = key[len(t.root.key)+len(t.separator):]
+	default:
+		return
+	}
+
+	// Child keys are cut from key itself so a key without a leading
+	// separator below the root keeps its exact spelling.
+	base := len(key) - len(rest)
+	node := t.root
+	for i := 0; ; {
+		j := -1
+		if t.separator != "" {
+			j = strings.Index(rest[i:], t.separator)
+		}
+		end := len(rest)
+		if j >= 0 {
+			end = i + j
+		}
+		node = node.child(rest[i:end], key[:base+end])
+		if j < 0 {
+			break
+		}
+		i = end + len(t.separator)
+	}
+	node.merge(fields)
+}
+
+func (n *treeNode) child(segment, key string) *treeNode {
+	if n.children == nil {
+		n.children = make(map[string]*treeNode)
+	}
+	c, ok := n.children[segment]
+	if !ok {
+		c = newTreeNode(key)
+		n.children[segment] = c
+	}
+	return c
+}
+
+func (n *treeNode) merge(fields map[string]interface{}) {
+	for k, v := range fields {
+		n.fields[k] = v
+	}
+}
+
+// Found reports whether the root key itself was added to the tree.
+func (t *Tree) Found() bool {
+	return t.found
+}
+
+// Root returns the root node with its descendants nested under "nodes",
+// sorted by key. Every node with children is marked as a directory.
+func (t *Tree) Root() map[string]interface{} {
+	return t.root.build()
+}
+
+func (n *treeNode) build() map[string]interface{} {
+	children := make([]*treeNode, 0, len(n.children))
+	for _, c := range n.children {
+		children = append(children, c)
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].key < children[j].key })
+
+	nodes := make([]map[string]interface{}, 0, len(children))
+	for _, c := range children {
+		nodes = append(nodes, c.build())
+	}
+	n.fields["nodes"] = nodes
+	if len(nodes) > 0 {
+		n.fields["dir"] = true
+	}
+	return n.fields
+}
@@ -0,0 +1,100 @@
+package etcd
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// shape returns the keys of node and its descendants, nested like the tree.
+func shape(node map[string]interface{}) interface{} {
+	nodes := node["nodes"].([]map[string]interface{})
+	if len(nodes) == 0 {
+		return node["key"]
+	}
+	children := make([]interface{}, 0, len(nodes))
+	for _, n := range nodes {
+		children = append(children, shape(n))
+	}
+	return []interface{}{node["key"], node["dir"], children}
+}
+
+func TestTreeNesting(t *testing.T) {
+	tree := NewTree("/app", "/")
+	tree.Add("/app/b/port", map[string]interface{}{"value": "80"})
+	tree.Add("/app/a", map[string]interface{}{"value": "1"})
+	tree.Add("/app/b/host", map[string]interface{}{"value": "h"})
+	tree.Add("/apps/x", nil)
+	tree.Add("/other", nil)
+
+	if tree.Found() {
+		t.Error("Found() = true before the root was added")
+	}
+	want := []interface{}{"/app", true, []interface{}{
+		"/app/a",
+		[]interface{}{"/app/b", true, []interface{}{"/app/b/host", "/app/b/port"}},
+	}}
+	root := tree.Root()
+	if got := shape(root); !reflect.DeepEqual(got, want) {
+		t.Errorf("tree = %v, want %v", got, want)
+	}
+	port := root["nodes"].([]map[string]interface{})[1]["nodes"].([]map[string]interface{})[1]
+	if port["value"] != "80" {
+		t.Errorf("value of /app/b/port = %v, want 80", port["value"])
+	}
+
+	tree.Add("/app", map[string]interface{}{"value": "root"})
+	if !tree.Found() || tree.Root()["value"] != "root" {
+		t.Error("root key was not merged into the root node")
+	}
+}
+
+func TestTreeSeparatorRoot(t *testing.T) {
+	tree := NewTree("/", "/")
+	tree.Add("/a/b", nil)
+	tree.Add("/c", nil)
+	tree.Add("d", nil)
+
+	want := []interface{}{"/", true, []interface{}{
+		[]interface{}{"/a", true, []interface{}{"/a/b"}},
+		"/c",
+		"d",
+	}}
+	if got := shape(tree.Root()); !reflect.DeepEqual(got, want) {
+		t.Errorf("tree = %v, want %v", got, want)
+	}
+}
+
+func TestTreeMultiCharacterSeparator(t *testing.T) {
+	tree := NewTree("app", "::")
+	tree.Add("app::a:b::c", nil)
+
+	want := []interface{}{"app", true, []interface{}{
+		[]interface{}{"app::a:b", true, []interface{}{"app::a:b::c"}},
+	}}
+	if got := shape(tree.Root()); !reflect.DeepEqual(got, want) {
+		t.Errorf("tree = %v, want %v", got, want)
+	}
+}
+
+func BenchmarkTreeAdd(b *testing.B) {
+	for _, size := range []struct {
+		name string
+		n    int
+	}{{"10k", 10000}, {"100k", 100000}, {"1M", 1000000}} {
+		n := size.n
+		keys := make([]string, n)
+		for i := range keys {
+			keys[i] = fmt.Sprintf("/bench/%d/%d/key%d", i%100, i/100%100, i)
+		}
+		fields := map[string]interface{}{"value": "v"}
+		b.Run(size.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				tree := NewTree("/bench", "/")
+				for _, key := range keys {
+					tree.Add(key, fields)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/apiv1/types"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// ErrInvalidTxn is wrapped by the errors TxnV3 returns for malformed
+// transactions, which are not sent to etcd.
+var ErrInvalidTxn = errors.New("invalid transaction")
+
+// TxnV3 runs txn. Values of compares and puts are decoded from encoding and
+// values in the results are encoded with it.
+func TxnV3(ctx context.Context, cli *ClientV3, txn Txn, encoding string) (*TxnResult, error) {
+	cmps := make([]clientv3.Cmp, 0, len(txn.Compare))
+	for i, c := range txn.Compare {
+		cmp, err := compare(c, encoding)
+		if err != nil {
+			return nil, fmt.Errorf("%w: compare %d: %v", ErrInvalidTxn, i, err)
+		}
+		cmps = append(cmps, cmp)
+	}
+	success, err := txnOps("success", txn.Success, encoding)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTxn, err)
+	}
+	failure, err := txnOps("failure", txn.Failure, encoding)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTxn, err)
+	}
+
+	resp, err := cli.Txn(ctx).If(cmps...).Then(success...).Else(failure...).Commit()
+	if err != nil {
+		return nil, err
+	}
+	ops := txn.Success
+	if !resp.Succeeded {
+		ops = txn.Failure
+	}
+	result := &TxnResult{
+		Succeeded: resp.Succeeded,
+		Revision:  resp.Header.Revision,
+		Results:   make([]TxnOpResult, 0, len(resp.Responses)),
+	}
+	for i, r := range resp.Responses {
+		op := TxnOpResult{Type: ops[i].Type, Key: ops[i].Key}
+		// Puts keeping the lease of their key run as a nested transaction.
+		if nested := r.GetResponseTxn(); nested != nil && len(nested.Responses) == 1 {
+			r = nested.Responses[0]
+		}
+		switch {
+		case r.GetResponsePut() != nil:
+			if prev := r.GetResponsePut().PrevKv; prev != nil {
+				op.PrevKvs = []KeyValue{newKeyValue(prev, encoding)}
+			}
+		case r.GetResponseDeleteRange() != nil:
+			del := r.GetResponseDeleteRange()
+			op.Deleted = del.Deleted
+			op.PrevKvs = newKeyValues(del.PrevKvs, encoding)
+		case r.GetResponseRange() != nil:
+			rng := r.GetResponseRange()
+			op.Count, op.More = rng.Count, rng.More
+			op.Kvs = newKeyValues(rng.Kvs, encoding)
+		}
+		result.Results = append(result.Results, op)
+	}
+	return result, nil
+}
+
+func compare(c Compare, encoding string) (clientv3.Cmp, error) {
+	switch c.Result {
+	case "=", "!=", "<", ">":
+	default:
+		return clientv3.Cmp{}, fmt.Errorf("invalid result %q, expected =, !=, < or >", c.Result)
+	}
+	switch c.Target {
+	case "value":
+		value, err := types.DecodeValue(c.Value, encoding)
+		if err != nil {
+			return clientv3.Cmp{}, err
+		}
+		return clientv3.Compare(clientv3.Value(c.Key), c.Result, string(value)), nil
+	case "version":
+		return clientv3.Compare(clientv3.Version(c.Key), c.Result, c.Version), nil
+	case "createRevision":
+		return clientv3.Compare(clientv3.CreateRevision(c.Key), c.Result, c.CreateRevision), nil
+	case "modRevision":
+		return clientv3.Compare(clientv3.ModRevision(c.Key), c.Result, c.ModRevision), nil
+	case "lease":
+		var id uint64
+		if c.Lease != "" {
+			var err error
+			if id, err = ParseID(c.Lease); err != nil {
+				return clientv3.Cmp{}, fmt.Errorf("invalid lease id %s", c.Lease)
+			}
+		}
+		return clientv3.Compare(clientv3.LeaseValue(c.Key), c.Result, int64(id)), nil
+	}
+	return clientv3.Cmp{}, fmt.Errorf("invalid target %q, expected value, version, createRevision, modRevision or lease", c.Target)
+}
+
+func txnOps(branch string, ops []TxnOp, encoding string) ([]clientv3.Op, error) {
+	list := make([]clientv3.Op, 0, len(ops))
+	for i, o := range ops {
+		op, err := txnOp(o, encoding)
+		if err != nil {
+			return nil, fmt.Errorf("%s op %d: %v", branch, i, err)
+		}
+		list = append(list, op)
+	}
+	return list, nil
+}
+
+func txnOp(o TxnOp, encoding string) (clientv3.Op, error) {
+	var opts []clientv3.OpOption
+	if o.Prefix {
+		opts = append(opts, clientv3.WithPrefix())
+	}
+	if o.PrevKV {
+		opts = append(opts, clientv3.WithPrevKV())
+	}
+	switch o.Type {
+	case "put":
+		if o.Prefix {
+			return clientv3.Op{}, fmt.Errorf("prefix is not supported by put")
+		}
+		value, err := types.DecodeValue(o.Value, encoding)
+		if err != nil {
+			return clientv3.Op{}, err
+		}
+		if n := countTrue(o.Lease != "", o.Detach, o.IgnoreLease); n > 1 {
+			return clientv3.Op{}, errors.New("lease, detach and ignoreLease are mutually exclusive")
+		}
+		switch {
+		case o.Lease != "":
+			id, err := ParseID(o.Lease)
+			if err != nil {
+				return clientv3.Op{}, fmt.Errorf("invalid lease id %s", o.Lease)
+			}
+			return clientv3.OpPut(o.Key, string(value), append(opts, clientv3.WithLease(clientv3.LeaseID(id)))...), nil
+		case o.Detach:
+			return clientv3.OpPut(o.Key, string(value), opts...), nil
+		}
+		// Keep the lease of the key like PutV3. WithIgnoreLease fails on a key
+		// that does not exist yet, hence the nested transaction.
+		return clientv3.OpTxn(
+			[]clientv3.Cmp{clientv3.Compare(clientv3.CreateRevision(o.Key), ">", 0)},
+			[]clientv3.Op{clientv3.OpPut(o.Key, string(value), append(opts, clientv3.WithIgnoreLease())...)},
+			[]clientv3.Op{clientv3.OpPut(o.Key, string(value), opts...)},
+		), nil
+	case "delete":
+		return clientv3.OpDelete(o.Key, opts...), nil
+	case "range":
+		if o.Limit > 0 {
+			opts = append(opts, clientv3.WithLimit(o.Limit))
+		}
+		if o.KeysOnly {
+			opts = append(opts, clientv3.WithKeysOnly())
+		}
+		return clientv3.OpGet(o.Key, opts...), nil
+	}
+	return clientv3.Op{}, fmt.Errorf("invalid type %q, expected put, delete or range", o.Type)
+}
+
+func newKeyValues(kvs []*mvccpb.KeyValue, encoding string) []KeyValue {
+	list := make([]KeyValue, 0, len(kvs))
+	for _, kv := range kvs {
+		list = append(list, newKeyValue(kv, encoding))
+	}
+	return list
+}
+
+func newKeyValue(kv *mvccpb.KeyValue, encoding string) KeyValue {
+	v := KeyValue{
+		Key:            string(kv.Key),
+		CreateRevision: kv.CreateRevision,
+		ModRevision:    kv.ModRevision,
+		Version:        kv.Version,
+	}
+	if len(kv.Value) > 0 {
+		v.Value, v.Encoding = types.EncodeValue(kv.Value, encoding)
+	}
+	if kv.Lease != 0 {
+		v.Lease = FormatID(uint64(kv.Lease))
+	}
+	return v
+}
+
+func countTrue(values ...bool) int {
+	n := 0
+	for _, v := range values {
+		if v {
+			n++
+		}
+	}
+	return n
+}
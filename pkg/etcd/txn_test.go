@@ -0,0 +1,28 @@
+package etcd
+
+import "testing"
+
+func TestTxnOpPutLease(t *testing.T) {
+	tests := []struct {
+		op     TxnOp
+		nested bool
+		ok     bool
+	}{
+		{TxnOp{Type: "put", Key: "a"}, true, true},
+		{TxnOp{Type: "put", Key: "a", IgnoreLease: true}, true, true},
+		{TxnOp{Type: "put", Key: "a", Lease: "1"}, false, true},
+		{TxnOp{Type: "put", Key: "a", Detach: true}, false, true},
+		{TxnOp{Type: "put", Key: "a", Lease: "1", Detach: true}, false, false},
+		{TxnOp{Type: "put", Key: "a", Detach: true, IgnoreLease: true}, false, false},
+	}
+	for _, tt := range tests {
+		op, err := txnOp(tt.op, "")
+		if (err == nil) != tt.ok {
+			t.Errorf("txnOp(%+v) error = %v, want ok %v", tt.op, err, tt.ok)
+			continue
+		}
+		if err == nil && op.IsTxn() != tt.nested {
+			t.Errorf("txnOp(%+v) nested = %v, want %v", tt.op, op.IsTxn(), tt.nested)
+		}
+	}
+}
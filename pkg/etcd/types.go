@@ -0,0 +1,25 @@
+package etcd
+
+import "github.com/trinhdaiphuc/etcdkeeper/pkg/apiv1/types"
+
+// The types below are part of the API responses. They are defined in
+// pkg/apiv1/types so that API clients do not depend on this package.
+type (
+	Compare        = types.Compare
+	TxnOp          = types.TxnOp
+	Txn            = types.Txn
+	KeyValue       = types.TxnKeyValue
+	TxnOpResult    = types.TxnOpResult
+	TxnResult      = types.TxnResult
+	BatchResult    = types.BatchResult
+	MemberStatus   = types.MemberStatus
+	Alarm          = types.Alarm
+	ClusterStatus  = types.ClusterStatus
+	Member         = types.Member
+	Lease          = types.Lease
+	Child          = types.Child
+	ChildrenPage   = types.ChildrenPage
+	Snippet        = types.Snippet
+	SearchResult   = types.SearchResult
+	SearchResponse = types.SearchResponse
+)
@@ -2,8 +2,8 @@ package etcd
 
 import (
 	"context"
-	"github.com/coreos/etcd/client"
 	"github.com/trinhdaiphuc/etcdkeeper/config"
+	"go.etcd.io/etcd/client/v2"
 	"sort"
 	"strings"
 )
@@ -19,6 +19,10 @@ func newClientV2(user UserInfo) (*ClientV2, error) {
 	cfg := client.Config{
 		Endpoints:               []string{user.Host},
 		HeaderTimeoutPerRequest: config.GetConfig().ConnectTimeout,
+		Transport: logTransport{
+			metricsTransport{client.DefaultTransport, user.Host},
+			UserInfo{Host: user.Host, Username: user.Username},
+		},
 	}
 	if config.GetConfig().UseAuth {
 		cfg.Username = user.Username
@@ -37,14 +41,30 @@ func newClientV2(user UserInfo) (*ClientV2, error) {
 	}, nil
 }
 
-func GetInfoV2(rootClient *ClientV2) (map[string]string, error) {
+// Close is a no-op, the v2 client is plain HTTP and holds no connection state.
+func (c *ClientV2) Close() error {
+	return nil
+}
+
+// Healthy reports whether the etcd server answers a version request.
+func (c *ClientV2) Healthy(ctx context.Context) error {
+	_, err := c.GetVersion(ctx)
+	return err
+}
+
+// Release hands the client back to the pool.
+func (c *ClientV2) Release() {
+	poolV2.release(c)
+}
+
+func GetInfoV2(ctx context.Context, rootClient *ClientV2) (map[string]string, error) {
 	info := make(map[string]string)
-	ver, err := rootClient.GetVersion(context.Background())
+	ver, err := rootClient.GetVersion(ctx)
 	if err != nil {
 		return nil, err
 	}
 	memberKapi := client.NewMembersAPI(rootClient)
-	member, err := memberKapi.Leader(context.Background())
+	member, err := memberKapi.Leader(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -54,53 +74,21 @@ func GetInfoV2(rootClient *ClientV2) (map[string]string, error) {
 	return info, nil
 }
 
-func GetNode(node *client.Node, selKey string, all map[int][]map[string]interface{}, min, max int) int {
-	separator := config.GetConfig().Separator
-	keys := strings.Split(node.Key, separator) // /foo/bar
-	if len(keys) < min && strings.HasPrefix(node.Key, selKey) {
-		return max
-	}
-	for i := range keys { // ["", "foo", "bar"]
-		k := strings.Join(keys[0:i+1], separator)
-		if k == "" {
-			continue
-		}
-		nodeMap := map[string]interface{}{"key": k, "dir": true, "nodes": make([]map[string]interface{}, 0)}
-		if k == node.Key {
-			nodeMap["value"] = node.Value
-			nodeMap["dir"] = node.Dir
-			nodeMap["ttl"] = node.TTL
-			nodeMap["createdIndex"] = node.CreatedIndex
-			nodeMap["modifiedIndex"] = node.ModifiedIndex
-		}
-		keylevel := len(strings.Split(k, separator))
-		if keylevel > max {
-			max = keylevel
-		}
-
-		if _, ok := all[keylevel]; !ok {
-			all[keylevel] = make([]map[string]interface{}, 0)
-		}
-		var isExist bool
-		for _, n := range all[keylevel] {
-			if n["key"].(string) == k {
-				isExist = true
-			}
-		}
-		if !isExist {
-			all[keylevel] = append(all[keylevel], nodeMap)
-		}
-	}
-
-	if len(node.Nodes) != 0 {
-		for _, n := range node.Nodes {
-			max = GetNode(n, selKey, all, min, max)
-		}
+// AddNodeV2 adds node and all of its descendants to tree.
+func AddNodeV2(tree *Tree, node *client.Node) {
+	tree.Add(node.Key, map[string]interface{}{
+		"value":         node.Value,
+		"dir":           node.Dir,
+		"ttl":           node.TTL,
+		"createdIndex":  node.CreatedIndex,
+		"modifiedIndex": node.ModifiedIndex,
+	})
+	for _, n := range node.Nodes {
+		AddNodeV2(tree, n)
 	}
-	return max
 }
 
-func GetPermissionPrefixV2(user UserInfo, key string) ([][]string, error) {
+func GetPermissionPrefixV2(ctx context.Context, user UserInfo, key string) ([][]string, error) {
 	if config.GetConfig().UseAuth {
 		return [][]string{{key, "p"}}, nil // No auth return all
 	} else {
@@ -115,22 +103,23 @@ func GetPermissionPrefixV2(user UserInfo, key string) ([][]string, error) {
 		if err != nil {
 			return nil, err
 		}
+		defer rootCli.Release()
 		rootUserKapi := client.NewAuthUserAPI(rootCli)
 		rootRoleKapi := client.NewAuthRoleAPI(rootCli)
 
-		if users, err := rootUserKapi.ListUsers(context.Background()); err != nil {
+		if users, err := rootUserKapi.ListUsers(ctx); err != nil {
 			return nil, err
 		} else {
 			// Find user permissions
 			set := make(map[string]string)
 			for _, u := range users {
 				if u == user.Username {
-					user, err := rootUserKapi.GetUser(context.Background(), u)
+					user, err := rootUserKapi.GetUser(ctx, u)
 					if err != nil {
 						return nil, err
 					}
 					for _, r := range user.Roles {
-						role, err := rootRoleKapi.GetRole(context.Background(), r)
+						role, err := rootRoleKapi.GetRole(ctx, r)
 						if err != nil {
 							return nil, err
 						}
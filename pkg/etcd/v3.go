@@ -3,12 +3,13 @@ package etcd
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
-	"github.com/coreos/etcd/clientv3"
-	"github.com/coreos/etcd/pkg/transport"
 	"github.com/trinhdaiphuc/etcdkeeper/config"
+	"go.etcd.io/etcd/client/pkg/v3/transport"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
 	"google.golang.org/grpc"
-	"log"
 )
 
 type ClientV3 struct {
@@ -33,9 +34,10 @@ func newClientV3(user UserInfo) (*ClientV3, error) {
 			KeyFile:       cfg.KeyFile,
 			TrustedCAFile: cfg.CaFile,
 		}
+		dialedTLS.Store(tlsStamp(cfg))
 		tlsConfig, err = tlsInfo.ClientConfig()
 		if err != nil {
-			log.Println(err.Error())
+			zap.L().Error("etcd: TLS configuration", zap.Error(err))
 		}
 	}
 
@@ -43,7 +45,11 @@ func newClientV3(user UserInfo) (*ClientV3, error) {
 		Endpoints:   endpoints,
 		DialTimeout: cfg.ConnectTimeout,
 		TLS:         tlsConfig,
-		DialOptions: []grpc.DialOption{grpc.WithBlock()},
+		DialOptions: []grpc.DialOption{grpc.WithBlock(), grpc.WithChainUnaryInterceptor(
+			unaryMetrics(user.Host),
+			unaryLogger(UserInfo{Host: user.Host, Username: user.Username}),
+		)},
+		Logger: zap.L().Named("etcd-client"),
 	}
 	if cfg.UseAuth {
 		conf.Username = user.Username
@@ -63,13 +69,25 @@ func newClientV3(user UserInfo) (*ClientV3, error) {
 	}, nil
 }
 
-func GetInfoV3(rootClient *ClientV3) (map[string]string, error) {
+// Healthy reports whether the endpoint the client was created for answers a
+// status request.
+func (c *ClientV3) Healthy(ctx context.Context) error {
+	_, err := c.Status(ctx, c.Host)
+	return err
+}
+
+// Release hands the client back to the pool.
+func (c *ClientV3) Release() {
+	poolV3.release(c)
+}
+
+func GetInfoV3(ctx context.Context, rootClient *ClientV3) (map[string]string, error) {
 	info := make(map[string]string)
-	status, err := rootClient.Status(context.Background(), rootClient.Host)
+	status, err := rootClient.Status(ctx, rootClient.Host)
 	if err != nil {
 		return nil, err
 	}
-	mems, err := rootClient.MemberList(context.Background())
+	mems, err := rootClient.MemberList(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -106,8 +124,8 @@ func GetInfoV3(rootClient *ClientV3) (map[string]string, error) {
 	return info, nil
 }
 
-func GetTTL(cli *ClientV3, lease int64) int64 {
-	resp, err := cli.Lease.TimeToLive(context.Background(), clientv3.LeaseID(lease))
+func GetTTL(ctx context.Context, cli *ClientV3, lease int64) int64 {
+	resp, err := cli.Lease.TimeToLive(ctx, clientv3.LeaseID(lease))
 	if err != nil {
 		return 0
 	}
@@ -117,8 +135,54 @@ func GetTTL(cli *ClientV3, lease int64) int64 {
 	return resp.TTL
 }
 
+// PutLease selects the lease a put attaches the key to. The zero value keeps
+// whatever lease the key already has, at most one field may be set.
+type PutLease struct {
+	// TTL grants a new lease with this TTL in seconds when positive.
+	TTL int64
+	// ID attaches the key to an existing lease when non zero.
+	ID int64
+	// Detach removes the key from its lease.
+	Detach bool
+}
+
+// Check reports a lease selecting more than one of a new lease, an existing
+// one and no lease.
+func (l PutLease) Check() error {
+	if countTrue(l.TTL != 0, l.ID != 0, l.Detach) > 1 {
+		return errors.New("ttl, lease and detach are mutually exclusive")
+	}
+	return nil
+}
+
+// PutV3 writes value to key, attaching it to the lease selected by lease.
+func PutV3(ctx context.Context, cli *ClientV3, key, value string, lease PutLease) error {
+	switch {
+	case lease.TTL > 0:
+		resp, err := cli.Grant(ctx, lease.TTL)
+		if err != nil {
+			return err
+		}
+		_, err = cli.Put(ctx, key, value, clientv3.WithLease(resp.ID))
+		return err
+	case lease.ID != 0:
+		_, err := cli.Put(ctx, key, value, clientv3.WithLease(clientv3.LeaseID(lease.ID)))
+		return err
+	case lease.Detach:
+		_, err := cli.Put(ctx, key, value)
+		return err
+	}
+	// WithIgnoreLease fails on a key that does not exist yet, so only use it
+	// when the key is already there.
+	_, err := cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), ">", 0)).
+		Then(clientv3.OpPut(key, value, clientv3.WithIgnoreLease())).
+		Else(clientv3.OpPut(key, value)).
+		Commit()
+	return err
+}
 
-func GetPermissionPrefix(user UserInfo, key string) ([][]string, error) {
+func GetPermissionPrefix(ctx context.Context, user UserInfo, key string) ([][]string, error) {
 	if !config.GetConfig().UseAuth {
 		return [][]string{{key, "p"}}, nil // No auth return all
 	} else {
@@ -129,21 +193,21 @@ func GetPermissionPrefix(user UserInfo, key string) ([][]string, error) {
 		if err != nil {
 			return nil, err
 		}
-		defer rootCli.Close()
+		defer rootCli.Release()
 
-		if resp, err := rootCli.UserList(context.Background()); err != nil {
+		if resp, err := rootCli.UserList(ctx); err != nil {
 			return nil, err
 		} else {
 			// Find user permissions
 			set := make(map[string]string)
 			for _, u := range resp.Users {
 				if u == user.Username {
-					ur, err := rootCli.UserGet(context.Background(), u)
+					ur, err := rootCli.UserGet(ctx, u)
 					if err != nil {
 						return nil, err
 					}
 					for _, r := range ur.Roles {
-						rr, err := rootCli.RoleGet(context.Background(), r)
+						rr, err := rootCli.RoleGet(ctx, r)
 						if err != nil {
 							return nil, err
 						}
@@ -163,7 +227,6 @@ func GetPermissionPrefix(user UserInfo, key string) ([][]string, error) {
 	}
 }
 
-
 func size(num int, unit int) (n, rem int) {
 	return num / unit, num - (num/unit)*unit
 }
@@ -0,0 +1,23 @@
+package etcd
+
+import "testing"
+
+func TestPutLeaseCheck(t *testing.T) {
+	tests := []struct {
+		lease PutLease
+		ok    bool
+	}{
+		{PutLease{}, true},
+		{PutLease{TTL: 60}, true},
+		{PutLease{ID: 1}, true},
+		{PutLease{Detach: true}, true},
+		{PutLease{TTL: 60, ID: 1}, false},
+		{PutLease{ID: 1, Detach: true}, false},
+		{PutLease{TTL: 60, Detach: true}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.lease.Check(); (err == nil) != tt.ok {
+			t.Errorf("%+v.Check() = %v, want ok %v", tt.lease, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+// Package formats validates and pretty-prints configuration values in the
+// formats the editor highlights.
+package formats
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/magiconair/properties"
+	"github.com/trinhdaiphuc/etcdkeeper/config"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/keymatch"
+	"gopkg.in/ini.v1"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	JSON       = "json"
+	YAML       = "yaml"
+	TOML       = "toml"
+	INI        = "ini"
+	XML        = "xml"
+	Properties = "properties"
+)
+
+const indent = "  "
+
+var formatters = map[string]func(value []byte, sortKeys bool) ([]byte, error){
+	JSON:       formatJSON,
+	YAML:       formatYAML,
+	TOML:       formatTOML,
+	INI:        formatINI,
+	XML:        formatXML,
+	Properties: formatProperties,
+}
+
+// extensions maps key name extensions to formats.
+var extensions = map[string]string{
+	".json":       JSON,
+	".yaml":       YAML,
+	".yml":        YAML,
+	".toml":       TOML,
+	".ini":        INI,
+	".xml":        XML,
+	".properties": Properties,
+}
+
+// Names returns the supported formats.
+func Names() []string {
+	names := make([]string, 0, len(formatters))
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Format parses value and prints it back indented. With sortKeys the keys
+// of JSON and YAML objects and of properties are sorted, TOML is always
+// written with sorted keys and without its comments.
+func Format(format string, value []byte, sortKeys bool) ([]byte, error) {
+	f, ok := formatters[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %s, expected one of %s", format, strings.Join(Names(), ", "))
+	}
+	out, err := f(value, sortKeys)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", format, err)
+	}
+	return out, nil
+}
+
+// Validate reports whether value is syntactically valid in format.
+func Validate(format string, value []byte) error {
+	_, err := Format(format, value, false)
+	return err
+}
+
+// ForKey returns the format key is tagged with: the first KEY_FORMATS
+// pattern matching it, or else the extension of its last segment. It is
+// empty for untagged keys.
+func ForKey(key string) string {
+	cfg := config.GetConfig()
+	for _, tag := range strings.Split(cfg.KeyFormats, ",") {
+		i := strings.LastIndex(tag, "=")
+		if i < 0 {
+			continue
+		}
+		pattern, err := keymatch.Compile(strings.TrimSpace(tag[:i]), cfg.Separator)
+		if err == nil && pattern.Match(key) {
+			return strings.TrimSpace(tag[i+1:])
+		}
+	}
+	name := key
+	if cfg.Separator != "" {
+		name = key[strings.LastIndex(key, cfg.Separator)+1:]
+	}
+	return extensions[strings.ToLower(path.Ext(name))]
+}
+
+func formatJSON(value []byte, sortKeys bool) ([]byte, error) {
+	if !sortKeys {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, value, "", indent); err != nil {
+			return nil, jsonError(value, err)
+		}
+		return buf.Bytes(), nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(value))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, jsonError(value, err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the top-level value")
+	}
+	// Maps are encoded with sorted keys.
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", indent)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// jsonError adds the line and column to syntax errors.
+func jsonError(value []byte, err error) error {
+	serr, ok := err.(*json.SyntaxError)
+	if !ok {
+		return err
+	}
+	before := value[:serr.Offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := len(before) - bytes.LastIndexByte(before, '\n')
+	return fmt.Errorf("line %d column %d: %v", line, col, err)
+}
+
+func formatYAML(value []byte, sortKeys bool) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(len(indent))
+	dec := yaml.NewDecoder(bytes.NewReader(value))
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if sortKeys {
+			sortYAML(&doc)
+		}
+		if err := enc.Encode(&doc); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func sortYAML(n *yaml.Node) {
+	if n.Kind == yaml.MappingNode {
+		pairs := make([][2]*yaml.Node, 0, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			pairs = append(pairs, [2]*yaml.Node{n.Content[i], n.Content[i+1]})
+		}
+		sort.SliceStable(pairs, func(i, j int) bool { return pairs[i][0].Value < pairs[j][0].Value })
+		for i, p := range pairs {
+			n.Content[2*i], n.Content[2*i+1] = p[0], p[1]
+		}
+	}
+	for _, c := range n.Content {
+		sortYAML(c)
+	}
+}
+
+func formatTOML(value []byte, _ bool) ([]byte, error) {
+	var v map[string]interface{}
+	if _, err := toml.Decode(string(value), &v); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := toml.NewEncoder(&buf)
+	enc.Indent = indent
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func formatINI(value []byte, _ bool) ([]byte, error) {
+	f, err := ini.Load(value)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if _, err = f.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func formatXML(value []byte, _ bool) ([]byte, error) {
+	var (
+		buf   bytes.Buffer
+		dec   = xml.NewDecoder(bytes.NewReader(value))
+		enc   = xml.NewEncoder(&buf)
+		roots int
+		depth int
+	)
+	enc.Indent("", indent)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				roots++
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) == 0 {
+				continue
+			}
+			if depth == 0 {
+				return nil, fmt.Errorf("text outside of the root element")
+			}
+		}
+		if err = enc.EncodeToken(tok); err != nil {
+			return nil, err
+		}
+		// The encoder only breaks lines around elements.
+		if _, ok := tok.(xml.ProcInst); ok && depth == 0 {
+			if err = enc.EncodeToken(xml.CharData("\n")); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if roots != 1 {
+		return nil, fmt.Errorf("expected a single root element, found %d", roots)
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func formatProperties(value []byte, sortKeys bool) ([]byte, error) {
+	l := &properties.Loader{Encoding: properties.UTF8, DisableExpansion: true}
+	p, err := l.LoadBytes(value)
+	if err != nil {
+		return nil, err
+	}
+	if sortKeys {
+		p.Sort()
+	}
+	var buf bytes.Buffer
+	if _, err = p.WriteComment(&buf, "# ", properties.UTF8); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
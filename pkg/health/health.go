@@ -0,0 +1,94 @@
+// Package health serves the probes of the server: /healthz tells whether the
+// process is up, /readyz whether it can serve the UI and reach the etcd
+// clusters listed in READY_CLUSTERS, and /version what build is running.
+// They answer without a token.
+package health
+
+import (
+	"context"
+	"io/fs"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/trinhdaiphuc/etcdkeeper/config"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/etcd"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/version"
+)
+
+// Status of a probe or of one of its checks.
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Report is the body of the probes.
+type Report struct {
+	Status string `json:"status"`
+	// Checks maps each check to ok or to the reason it failed.
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Healthz answers 200 as long as the server handles requests. It checks
+// nothing else so that an etcd outage does not get the process restarted.
+func Healthz(c echo.Context) error {
+	return c.JSON(http.StatusOK, Report{Status: StatusOK})
+}
+
+// Readyz returns the readiness probe. It answers 200 when the UI files are
+// in assets and every cluster of READY_CLUSTERS answers a status request
+// within CONNECT_TIMEOUT, 503 otherwise.
+func Readyz(assets fs.FS) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		cfg := config.GetConfig()
+		report := Report{Status: StatusOK, Checks: map[string]string{}}
+		var mu sync.Mutex
+		record := func(name string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = StatusOK
+			if err != nil {
+				report.Checks[name] = err.Error()
+				report.Status = StatusFail
+			}
+		}
+
+		record("assets", checkAssets(assets))
+		ctx, cancel := context.WithTimeout(c.Request().Context(), cfg.ConnectTimeout)
+		defer cancel()
+		var wg sync.WaitGroup
+		for _, host := range strings.Split(cfg.ReadyClusters, ",") {
+			host = strings.TrimSpace(host)
+			if host == "" {
+				continue
+			}
+			wg.Add(1)
+			go func(host string) {
+				defer wg.Done()
+				record("etcd "+host, etcd.Ping(ctx, host))
+			}(host)
+		}
+		wg.Wait()
+
+		code := http.StatusOK
+		if report.Status != StatusOK {
+			code = http.StatusServiceUnavailable
+		}
+		return c.JSON(code, report)
+	}
+}
+
+// checkAssets makes sure the page and the static files of the UI are there.
+func checkAssets(assets fs.FS) error {
+	if _, err := fs.Stat(assets, "index.html"); err != nil {
+		return err
+	}
+	_, err := fs.ReadDir(assets, "static")
+	return err
+}
+
+// Version answers the build information of the server.
+func Version(c echo.Context) error {
+	return c.JSON(http.StatusOK, version.Get())
+}
@@ -0,0 +1,167 @@
+// Package keymatch matches etcd keys against glob patterns that understand
+// the key separator.
+//
+// A pattern is matched against the whole key. A single star matches any run
+// of characters within one key segment, a double star matches any run of
+// characters including separators and a question mark matches one character
+// other than the separator. Every other character matches itself.
+package keymatch
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	literal tokenKind = iota
+	// question matches one character of a segment.
+	question
+	// star matches a run of characters within a segment.
+	star
+	// doubleStar matches any run of characters, separators included.
+	doubleStar
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// Pattern is a compiled glob pattern.
+type Pattern struct {
+	glob      string
+	separator string
+	tokens    []token
+}
+
+// Compile compiles a glob pattern for keys split by separator. Separators of
+// several characters are matched as a whole: with "::", a star matches a
+// single colon but not two. The glob and the separator must not be empty,
+// and runs of three stars or more are rejected as ambiguous.
+func Compile(glob, separator string) (*Pattern, error) {
+	switch {
+	case glob == "":
+		return nil, errors.New("empty pattern")
+	case separator == "":
+		return nil, errors.New("empty separator")
+	case strings.Contains(glob, "***"):
+		return nil, fmt.Errorf("pattern %s: use * or ** rather than ***", glob)
+	}
+	p := &Pattern{glob: glob, separator: separator}
+	var lit strings.Builder
+	flush := func() {
+		if lit.Len() > 0 {
+			p.tokens = append(p.tokens, token{kind: literal, text: lit.String()})
+			lit.Reset()
+		}
+	}
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			flush()
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				p.tokens = append(p.tokens, token{kind: doubleStar})
+				i++
+			} else {
+				p.tokens = append(p.tokens, token{kind: star})
+			}
+		case '?':
+			flush()
+			p.tokens = append(p.tokens, token{kind: question})
+		default:
+			lit.WriteByte(c)
+		}
+	}
+	flush()
+	return p, nil
+}
+
+// Match reports whether key matches the pattern.
+func (p *Pattern) Match(key string) bool {
+	m := matcher{tokens: p.tokens, key: key, inSep: separators(key, p.separator), failed: map[[2]int]bool{}}
+	return m.match(0, 0)
+}
+
+// separators marks the bytes of key that belong to a separator, splitting
+// it the way strings.Split does.
+func separators(key, separator string) []bool {
+	inSep := make([]bool, len(key))
+	if separator == "" {
+		return inSep
+	}
+	for i := 0; i < len(key); {
+		j := strings.Index(key[i:], separator)
+		if j < 0 {
+			break
+		}
+		for k := i + j; k < i+j+len(separator); k++ {
+			inSep[k] = true
+		}
+		i += j + len(separator)
+	}
+	return inSep
+}
+
+type matcher struct {
+	tokens []token
+	key    string
+	inSep  []bool
+	// failed remembers the wildcard positions known not to match, keeping
+	// patterns with many stars linear in practice.
+	failed map[[2]int]bool
+}
+
+// match reports whether the tokens from t match the key from byte i.
+func (m *matcher) match(t, i int) bool {
+	for ; t < len(m.tokens); t++ {
+		tok := m.tokens[t]
+		switch tok.kind {
+		case literal:
+			if !strings.HasPrefix(m.key[i:], tok.text) {
+				return false
+			}
+			i += len(tok.text)
+		case question:
+			if i >= len(m.key) || m.inSep[i] {
+				return false
+			}
+			_, size := utf8.DecodeRuneInString(m.key[i:])
+			i += size
+		default:
+			state := [2]int{t, i}
+			if m.failed[state] {
+				return false
+			}
+			for j := i; ; {
+				if m.match(t+1, j) {
+					return true
+				}
+				if j >= len(m.key) || (tok.kind == star && m.inSep[j]) {
+					break
+				}
+				_, size := utf8.DecodeRuneInString(m.key[j:])
+				j += size
+			}
+			m.failed[state] = true
+			return false
+		}
+	}
+	return i == len(m.key)
+}
+
+// Literal returns the part of the pattern before its first wildcard, every
+// matching key starts with it.
+func (p *Pattern) Literal() string {
+	if i := strings.IndexAny(p.glob, "*?"); i >= 0 {
+		return p.glob[:i]
+	}
+	return p.glob
+}
+
+func (p *Pattern) String() string {
+	return p.glob
+}
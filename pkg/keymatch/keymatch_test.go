@@ -0,0 +1,78 @@
+package keymatch
+
+import "testing"
+
+func mustCompile(t *testing.T, glob, separator string) *Pattern {
+	t.Helper()
+	p, err := Compile(glob, separator)
+	if err != nil {
+		t.Fatalf("Compile(%q, %q): %v", glob, separator, err)
+	}
+	return p
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		glob, separator, key string
+		want                 bool
+	}{
+		{"/app/*", "/", "/app/name", true},
+		{"/app/*", "/", "/app/a/b", false},
+		{"/app/**", "/", "/app/a/b", true},
+		{"/app/**/port", "/", "/app/a/b/port", true},
+		{"/app/*/port", "/", "/app/a/b/port", false},
+		{"/app/?", "/", "/app/x", true},
+		{"/app/?", "/", "/app/xy", false},
+		{"/app/?", "/", "/app//", false},
+		{"/app/?", "/", "/app/é", true},
+		{"/app/name", "/", "/app/name", true},
+		{"/app/name", "/", "/app/names", false},
+
+		{"app::*", "::", "app::a:b", true},
+		{"app::*", "::", "app::a::b", false},
+		{"app::**", "::", "app::a::b", true},
+		{"app::*::port", "::", "app::a:b::port", true},
+		{"app::?::port", "::", "app:::::port", false},
+		{"app::?", "::", "app:::", true},
+
+		{"a->*", "->", "a->b-c>d", true},
+		{"a->*", "->", "a->b->c", false},
+		{"a->*->c", "->", "a->b>->c", true},
+		{"a->**", "->", "a->b->c", true},
+		{"a->?", "->", "a->-", true},
+
+		{"*a*a*a*a*a*b", "/", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", false},
+	}
+	for _, tt := range tests {
+		p := mustCompile(t, tt.glob, tt.separator)
+		if got := p.Match(tt.key); got != tt.want {
+			t.Errorf("Compile(%q, %q).Match(%q) = %v, want %v", tt.glob, tt.separator, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestLiteral(t *testing.T) {
+	tests := []struct{ glob, want string }{
+		{"/app/name", "/app/name"},
+		{"/app/*/port", "/app/"},
+		{"/app/?", "/app/"},
+		{"**", ""},
+	}
+	for _, tt := range tests {
+		if got := mustCompile(t, tt.glob, "/").Literal(); got != tt.want {
+			t.Errorf("Literal(%q) = %q, want %q", tt.glob, got, tt.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, tt := range []struct{ glob, separator string }{
+		{"", "/"},
+		{"/app/*", ""},
+		{"/app/***", "/"},
+	} {
+		if _, err := Compile(tt.glob, tt.separator); err == nil {
+			t.Errorf("Compile(%q, %q) succeeded, want an error", tt.glob, tt.separator)
+		}
+	}
+}
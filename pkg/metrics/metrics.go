@@ -0,0 +1,134 @@
+// Package metrics exposes the Prometheus metrics of the server on /metrics.
+// The HTTP metrics are recorded here, the etcd and client pool metrics by
+// the etcd package and the watch streams by the API.
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/trinhdaiphuc/etcdkeeper/config"
+)
+
+// sessionWindow is how recently a user must have made a request to count as
+// an active session.
+const sessionWindow = 5 * time.Minute
+
+var (
+	requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "etcdkeeper_http_requests_total",
+		Help: "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "etcdkeeper_http_request_duration_seconds",
+		Help:    "Duration of the HTTP requests by route and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	sessions = &sessionSet{seen: make(map[string]time.Time)}
+
+	// knownMethods are the HTTP methods labelled by name, clients can send
+	// any other.
+	knownMethods = map[string]bool{
+		http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+		http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+	}
+)
+
+func init() {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "etcdkeeper_active_sessions",
+		Help: "Logged in users, per cluster and etcd user, that made a request in the last 5 minutes.",
+	}, func() float64 { return float64(sessions.active(time.Now())) })
+}
+
+// Middleware records the HTTP metrics of every request. session returns the
+// logged in user of a request, if any, once the request was handled.
+func Middleware(session func(echo.Context) string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+			// Errors not written yet are answered by echo's error handler.
+			status := c.Response().Status
+			if err != nil && !c.Response().Committed {
+				status = http.StatusInternalServerError
+				if he, ok := err.(*echo.HTTPError); ok {
+					status = he.Code
+				}
+			}
+			// The route pattern rather than the URL keeps the number of series
+			// bounded, requests matching no route share one. Echo leaves their
+			// URL path as c.Path().
+			route := c.Path()
+			if route == "" || isFallback(c.Handler()) {
+				route = "unmatched"
+			}
+			method := c.Request().Method
+			if !knownMethods[method] {
+				method = "other"
+			}
+			requests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+			requestDuration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+			if name := session(c); name != "" {
+				sessions.touch(name, start)
+			}
+			return err
+		}
+	}
+}
+
+// isFallback tells whether h is the handler echo answers requests matching
+// no route with.
+func isFallback(h echo.HandlerFunc) bool {
+	p := reflect.ValueOf(h).Pointer()
+	return p == reflect.ValueOf(echo.NotFoundHandler).Pointer() || p == reflect.ValueOf(echo.MethodNotAllowedHandler).Pointer()
+}
+
+// Handler serves the metrics in the Prometheus text format. When
+// METRICS_TOKEN is set, requests must bear it as an Authorization header.
+func Handler() echo.HandlerFunc {
+	h := echo.WrapHandler(promhttp.Handler())
+	return func(c echo.Context) error {
+		if token := config.GetConfig().MetricsToken; token != "" {
+			auth := c.Request().Header.Get(echo.HeaderAuthorization)
+			if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+token)) != 1 {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+				return echo.NewHTTPError(http.StatusUnauthorized)
+			}
+		}
+		return h(c)
+	}
+}
+
+// sessionSet tracks when each user last made a request.
+type sessionSet struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func (s *sessionSet) touch(name string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seen[name] = now
+}
+
+// active counts the recent users and forgets the others.
+func (s *sessionSet) active(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, last := range s.seen {
+		if now.Sub(last) > sessionWindow {
+			delete(s.seen, name)
+		}
+	}
+	return len(s.seen)
+}
@@ -0,0 +1,43 @@
+package middlewares
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/trinhdaiphuc/etcdkeeper/config"
+)
+
+// IsAdmin reports whether the user of the request may run admin operations.
+// With etcd auth enabled the user must be listed in ADMIN_USERS, without it
+// admin operations are only available when ALLOW_ADMIN_WITHOUT_AUTH is set.
+// API tokens never grant admin operations.
+func IsAdmin(c echo.Context) bool {
+	if c.Get(TokenKey) != nil {
+		return false
+	}
+	cfg := config.GetConfig()
+	if !cfg.UseAuth {
+		return cfg.AllowAdminWithoutAuth
+	}
+	user, ok := GetUserInfo(c)
+	if !ok {
+		return false
+	}
+	for _, name := range strings.Split(cfg.AdminUsers, ",") {
+		if strings.TrimSpace(name) == user.Username {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminOnly rejects requests from users that are not admins.
+func AdminOnly(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !IsAdmin(c) {
+			return echo.NewHTTPError(http.StatusForbidden, "admin privileges required")
+		}
+		return next(c)
+	}
+}
@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/trinhdaiphuc/etcdkeeper/config"
+)
+
+// ClientCert rejects HTTPS requests without a verified client certificate
+// when SERVER_CLIENT_CA_FILE is set. The TLS handshake only verifies the
+// certificates clients send, so that the kubelet can reach the probes
+// without one. The routes of skip are left open.
+func ClientCert(skip ...string) echo.MiddlewareFunc {
+	open := make(map[string]bool, len(skip))
+	for _, path := range skip {
+		open[path] = true
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			state := c.Request().TLS
+			if state == nil || config.GetConfig().ServerClientCaFile == "" || open[c.Path()] {
+				return next(c)
+			}
+			if len(state.VerifiedChains) == 0 {
+				return echo.NewHTTPError(http.StatusUnauthorized, "client certificate required")
+			}
+			return next(c)
+		}
+	}
+}
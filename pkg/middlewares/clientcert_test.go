@@ -0,0 +1,56 @@
+package middlewares
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/trinhdaiphuc/etcdkeeper/config"
+)
+
+func TestClientCert(t *testing.T) {
+	// Only the presence of the files is checked by config.Load.
+	dir := t.TempDir()
+	var args []string
+	for _, name := range []string{"server-cert-file", "server-key-file", "server-client-ca-file"} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		args = append(args, "-"+name, path)
+	}
+	if _, err := config.Load(config.NewFlagSet("test"), args); err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.Use(ClientCert("/healthz"))
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	e.GET("/healthz", ok)
+	e.GET("/api", ok)
+
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+	tests := []struct {
+		path  string
+		state *tls.ConnectionState
+		want  int
+	}{
+		{"/api", nil, http.StatusOK},
+		{"/api", &tls.ConnectionState{}, http.StatusUnauthorized},
+		{"/api", verified, http.StatusOK},
+		{"/healthz", &tls.ConnectionState{}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.TLS = tt.state
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s with TLS %+v: status %d, want %d", tt.path, tt.state, rec.Code, tt.want)
+		}
+	}
+}
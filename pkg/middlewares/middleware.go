@@ -17,6 +17,9 @@ type JwtCustomClaims struct {
 
 const (
 	UserKey = "user"
+	// TokenKey holds the *tokens.Token of requests authenticated with an API
+	// token.
+	TokenKey = "apiToken"
 )
 
 func NewToken(user *etcd.UserInfo) (string, error) {
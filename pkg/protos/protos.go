@@ -0,0 +1,402 @@
+// Package protos renders protobuf values as JSON. Admins upload
+// FileDescriptorSet files, as written by protoc --descriptor_set_out, and map
+// key patterns to the message types stored under them. Both are kept in the
+// directory set by PROTO_DIR.
+package protos
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/trinhdaiphuc/etcdkeeper/config"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/keymatch"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	// Well-known types, descriptor sets may import them without including them.
+	_ "google.golang.org/protobuf/types/known/anypb"
+	_ "google.golang.org/protobuf/types/known/durationpb"
+	_ "google.golang.org/protobuf/types/known/emptypb"
+	_ "google.golang.org/protobuf/types/known/fieldmaskpb"
+	_ "google.golang.org/protobuf/types/known/structpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	_ "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const (
+	descriptorExt = ".pb"
+	mappingsFile  = "mappings.json"
+)
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Mapping maps the keys matching a glob pattern to a message type.
+type Mapping struct {
+	Pattern string `json:"pattern"`
+	Message string `json:"message"`
+
+	match *keymatch.Pattern
+}
+
+// Registry holds the uploaded descriptor sets and the key mappings.
+type Registry struct {
+	dir       string
+	separator string
+
+	mu       sync.RWMutex
+	sets     map[string]*descriptorpb.FileDescriptorSet
+	files    *protoregistry.Files
+	mappings []Mapping
+}
+
+var (
+	once     sync.Once
+	registry *Registry
+)
+
+// Default returns the registry of the configured directory, loading it on
+// first use. A directory that cannot be read leaves the registry empty.
+func Default() *Registry {
+	once.Do(func() {
+		cfg := config.GetConfig()
+		var err error
+		if registry, err = Open(cfg.ProtoDir, cfg.Separator); err != nil {
+			zap.L().Error("protos: load", zap.String("dir", cfg.ProtoDir), zap.Error(err))
+			registry = newRegistry(cfg.ProtoDir, cfg.Separator)
+		}
+	})
+	return registry
+}
+
+func newRegistry(dir, separator string) *Registry {
+	return &Registry{
+		dir:       dir,
+		separator: separator,
+		sets:      make(map[string]*descriptorpb.FileDescriptorSet),
+		files:     new(protoregistry.Files),
+	}
+}
+
+// Open loads the descriptor sets and mappings saved in dir. A missing
+// directory is an empty registry.
+func Open(dir, separator string) (*Registry, error) {
+	r := newRegistry(dir, separator)
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != descriptorExt {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		set := new(descriptorpb.FileDescriptorSet)
+		if err = proto.Unmarshal(data, set); err != nil {
+			return nil, fmt.Errorf("%s: %v", e.Name(), err)
+		}
+		r.sets[strings.TrimSuffix(e.Name(), descriptorExt)] = set
+	}
+	if r.files, err = buildFiles(r.sets); err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, mappingsFile))
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var mappings []Mapping
+	if err = json.Unmarshal(data, &mappings); err != nil {
+		return nil, fmt.Errorf("%s: %v", mappingsFile, err)
+	}
+	for _, m := range mappings {
+		if m.match, err = r.compile(m, r.files); err != nil {
+			return nil, err
+		}
+		r.mappings = append(r.mappings, m)
+	}
+	return r, nil
+}
+
+// buildFiles resolves the files of every set together so that a set may
+// import files of another one. Well-known types missing from the sets are
+// taken from the ones linked into the binary.
+func buildFiles(sets map[string]*descriptorpb.FileDescriptorSet) (*protoregistry.Files, error) {
+	names := make([]string, 0, len(sets))
+	for name := range sets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var (
+		all  = new(descriptorpb.FileDescriptorSet)
+		seen = make(map[string]bool)
+	)
+	for _, name := range names {
+		for _, f := range sets[name].File {
+			if !seen[f.GetName()] {
+				seen[f.GetName()] = true
+				all.File = append(all.File, f)
+			}
+		}
+	}
+	for _, f := range all.File {
+		for _, dep := range f.Dependency {
+			if seen[dep] {
+				continue
+			}
+			if fd, err := protoregistry.GlobalFiles.FindFileByPath(dep); err == nil {
+				seen[dep] = true
+				all.File = append(all.File, protodesc.ToFileDescriptorProto(fd))
+			}
+		}
+	}
+	return protodesc.NewFiles(all)
+}
+
+func (r *Registry) compile(m Mapping, files *protoregistry.Files) (*keymatch.Pattern, error) {
+	if _, err := findMessage(files, m.Message); err != nil {
+		return nil, fmt.Errorf("mapping %s: %v", m.Pattern, err)
+	}
+	return keymatch.Compile(m.Pattern, r.separator)
+}
+
+func findMessage(files *protoregistry.Files, name string) (protoreflect.MessageDescriptor, error) {
+	d, err := files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("unknown message type %s", name)
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message type", name)
+	}
+	return md, nil
+}
+
+// DescriptorSets returns the names of the uploaded descriptor sets.
+func (r *Registry) DescriptorSets() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.sets))
+	for name := range r.sets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Messages returns the full names of every known message type.
+func (r *Registry) Messages() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0)
+	r.files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		addMessages(&names, fd.Messages())
+		return true
+	})
+	sort.Strings(names)
+	return names
+}
+
+func addMessages(names *[]string, msgs protoreflect.MessageDescriptors) {
+	for i := 0; i < msgs.Len(); i++ {
+		md := msgs.Get(i)
+		if md.IsMapEntry() {
+			continue
+		}
+		*names = append(*names, string(md.FullName()))
+		addMessages(names, md.Messages())
+	}
+}
+
+// Mappings returns the key mappings in the order they are matched.
+func (r *Registry) Mappings() []Mapping {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append(make([]Mapping, 0, len(r.mappings)), r.mappings...)
+}
+
+// AddDescriptorSet saves a serialized FileDescriptorSet under name,
+// replacing the set of the same name.
+func (r *Registry) AddDescriptorSet(name string, data []byte) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid descriptor set name %q", name)
+	}
+	set := new(descriptorpb.FileDescriptorSet)
+	if err := proto.Unmarshal(data, set); err != nil {
+		return fmt.Errorf("invalid descriptor set: %v", err)
+	}
+	if len(set.File) == 0 {
+		return fmt.Errorf("descriptor set %s has no files", name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sets := r.copySets()
+	sets[name] = set
+	files, err := r.checkSets(sets)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(r.dir, 0700); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(filepath.Join(r.dir, name+descriptorExt), data, 0600); err != nil {
+		return err
+	}
+	r.sets, r.files = sets, files
+	return nil
+}
+
+// RemoveDescriptorSet deletes a descriptor set. It fails while a mapping
+// still needs one of its message types.
+func (r *Registry) RemoveDescriptorSet(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.sets[name]; !ok {
+		return fmt.Errorf("descriptor set %s not found", name)
+	}
+	sets := r.copySets()
+	delete(sets, name)
+	files, err := r.checkSets(sets)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(filepath.Join(r.dir, name+descriptorExt)); err != nil {
+		return err
+	}
+	r.sets, r.files = sets, files
+	return nil
+}
+
+func (r *Registry) copySets() map[string]*descriptorpb.FileDescriptorSet {
+	sets := make(map[string]*descriptorpb.FileDescriptorSet, len(r.sets)+1)
+	for name, set := range r.sets {
+		sets[name] = set
+	}
+	return sets
+}
+
+// checkSets returns the files of sets once they resolve and every mapping
+// still points to a known message type. The registry switches to them only
+// after the directory is updated, so that it never serves sets the next
+// start would not load. Callers hold the write lock.
+func (r *Registry) checkSets(sets map[string]*descriptorpb.FileDescriptorSet) (*protoregistry.Files, error) {
+	files, err := buildFiles(sets)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range r.mappings {
+		if _, err = findMessage(files, m.Message); err != nil {
+			return nil, fmt.Errorf("mapping %s: %v", m.Pattern, err)
+		}
+	}
+	return files, nil
+}
+
+// SetMapping maps the keys matching pattern to a message type. An existing
+// mapping of the same pattern is replaced, a new one is matched last.
+func (r *Registry) SetMapping(pattern, message string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := Mapping{Pattern: pattern, Message: message}
+	var err error
+	if m.match, err = r.compile(m, r.files); err != nil {
+		return err
+	}
+	mappings := append(make([]Mapping, 0, len(r.mappings)+1), r.mappings...)
+	replaced := false
+	for i := range mappings {
+		if mappings[i].Pattern == pattern {
+			mappings[i], replaced = m, true
+		}
+	}
+	if !replaced {
+		mappings = append(mappings, m)
+	}
+	return r.saveMappings(mappings)
+}
+
+// RemoveMapping deletes the mapping of pattern.
+func (r *Registry) RemoveMapping(pattern string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	mappings := make([]Mapping, 0, len(r.mappings))
+	for _, m := range r.mappings {
+		if m.Pattern != pattern {
+			mappings = append(mappings, m)
+		}
+	}
+	if len(mappings) == len(r.mappings) {
+		return fmt.Errorf("mapping %s not found", pattern)
+	}
+	return r.saveMappings(mappings)
+}
+
+func (r *Registry) saveMappings(mappings []Mapping) error {
+	data, err := json.MarshalIndent(mappings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(r.dir, 0700); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(filepath.Join(r.dir, mappingsFile), data, 0600); err != nil {
+		return err
+	}
+	r.mappings = mappings
+	return nil
+}
+
+// Lookup returns the message type of the first mapping matching key.
+func (r *Registry) Lookup(key string) (protoreflect.MessageDescriptor, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, m := range r.mappings {
+		if m.match.Match(key) {
+			md, err := findMessage(r.files, m.Message)
+			return md, err == nil
+		}
+	}
+	return nil, false
+}
+
+// ToJSON decodes a serialized message of type md and renders it as JSON.
+func ToJSON(md protoreflect.MessageDescriptor, value []byte) ([]byte, error) {
+	msg := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(value, msg); err != nil {
+		return nil, fmt.Errorf("decode %s: %v", md.FullName(), err)
+	}
+	return protojson.MarshalOptions{Multiline: true, Indent: "  "}.Marshal(msg)
+}
+
+// FromJSON parses the JSON rendering of a message of type md and serializes
+// the message.
+func FromJSON(md protoreflect.MessageDescriptor, data []byte) ([]byte, error) {
+	msg := dynamicpb.NewMessage(md)
+	if err := protojson.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("encode %s: %v", md.FullName(), err)
+	}
+	return proto.Marshal(msg)
+}
@@ -0,0 +1,554 @@
+package routers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/trinhdaiphuc/etcdkeeper/config"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/apiv1/types"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/client"
+)
+
+// The tests below check the routes of /api/v1, the requests of pkg/client
+// and the responses of the handlers against the OpenAPI document served at
+// /openapi.json.
+
+const apiPrefix = "/api/v1"
+
+type openAPI struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas   map[string]schema   `json:"schemas"`
+		Responses map[string]response `json:"responses"`
+	} `json:"components"`
+}
+
+type response struct {
+	Ref     string `json:"$ref"`
+	Content map[string]struct {
+		Schema schema `json:"schema"`
+	} `json:"content"`
+}
+
+type parameter struct {
+	Name string `json:"name"`
+	In   string `json:"in"`
+}
+
+type operation struct {
+	Parameters  []parameter `json:"parameters"`
+	RequestBody *struct {
+		Content map[string]struct {
+			Schema schema `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]json.RawMessage `json:"responses"`
+}
+
+type schema struct {
+	Ref        string            `json:"$ref"`
+	Type       string            `json:"type"`
+	Properties map[string]schema `json:"properties"`
+	Required   []string          `json:"required"`
+	Items      *schema           `json:"items"`
+	Enum       []interface{}     `json:"enum"`
+	AllOf      []schema          `json:"allOf"`
+	// AdditionalProperties is true or the schema of the values of a map.
+	AdditionalProperties json.RawMessage `json:"additionalProperties"`
+}
+
+func loadSpec(t *testing.T) *openAPI {
+	data, err := ioutil.ReadFile("../apiv1/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec openAPI
+	if err = json.Unmarshal(data, &spec); err != nil {
+		t.Fatal(err)
+	}
+	return &spec
+}
+
+// operation returns the operation of method on the documented path, along
+// with the parameters of the path and of the operation.
+func (s *openAPI) operation(path, method string) (*operation, []parameter, bool) {
+	item, ok := s.Paths[path]
+	if !ok {
+		return nil, nil, false
+	}
+	raw, ok := item[strings.ToLower(method)]
+	if !ok {
+		return nil, nil, false
+	}
+	var op operation
+	if err := json.Unmarshal(raw, &op); err != nil {
+		return nil, nil, false
+	}
+	var params []parameter
+	if raw, ok := item["parameters"]; ok {
+		if err := json.Unmarshal(raw, &params); err != nil {
+			return nil, nil, false
+		}
+	}
+	return &op, append(params, op.Parameters...), true
+}
+
+// match returns the documented path template matching path, such as
+// /leases/{id} for /leases/1.
+func (s *openAPI) match(path string) (string, bool) {
+	segments := strings.Split(path, "/")
+	for template := range s.Paths {
+		parts := strings.Split(template, "/")
+		if len(parts) != len(segments) {
+			continue
+		}
+		matched := true
+		for i, part := range parts {
+			if part != segments[i] && !(strings.HasPrefix(part, "{") && segments[i] != "") {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return template, true
+		}
+	}
+	return "", false
+}
+
+// properties returns the properties of an object schema, following $ref and
+// allOf.
+func (s *openAPI) properties(sc schema) map[string]bool {
+	props := make(map[string]bool)
+	if sc.Ref != "" {
+		return s.properties(s.Components.Schemas[strings.TrimPrefix(sc.Ref, "#/components/schemas/")])
+	}
+	for name := range sc.Properties {
+		props[name] = true
+	}
+	for _, sub := range sc.AllOf {
+		for name := range s.properties(sub) {
+			props[name] = true
+		}
+	}
+	return props
+}
+
+func TestRoutesDocumented(t *testing.T) {
+	spec := loadSpec(t)
+	e := echo.New()
+	SetRoutes(e, fstest.MapFS{})
+
+	registered := make(map[string]bool)
+	for _, r := range e.Routes() {
+		// Groups with middleware register catch-all routes of echo's own.
+		if !strings.HasPrefix(r.Path, apiPrefix+"/") || strings.HasPrefix(r.Name, "github.com/labstack/echo/") {
+			continue
+		}
+		parts := strings.Split(strings.TrimPrefix(r.Path, apiPrefix), "/")
+		for i, part := range parts {
+			if strings.HasPrefix(part, ":") {
+				parts[i] = "{" + part[1:] + "}"
+			}
+		}
+		path := strings.Join(parts, "/")
+		registered[r.Method+" "+path] = true
+		if _, _, ok := spec.operation(path, r.Method); !ok {
+			t.Errorf("route %s %s is not in openapi.json", r.Method, r.Path)
+		}
+	}
+	for path, item := range spec.Paths {
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			if !registered[strings.ToUpper(method)+" "+path] {
+				t.Errorf("openapi.json documents %s %s, which is not registered", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+func TestClientDocumented(t *testing.T) {
+	spec := loadSpec(t)
+	var called []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := r.Method + " " + r.URL.Path
+		called = append(called, request)
+		path, ok := spec.match(strings.TrimPrefix(r.URL.Path, apiPrefix))
+		op, params, found := spec.operation(path, r.Method)
+		if !ok || !found {
+			t.Errorf("%s is not in openapi.json", request)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		query := make(map[string]bool)
+		for _, p := range params {
+			if p.In == "query" {
+				query[p.Name] = true
+			}
+		}
+		for name := range r.URL.Query() {
+			if !query[name] {
+				t.Errorf("%s: query parameter %s is not documented", request, name)
+			}
+		}
+
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+			t.Errorf("%s: %v", request, err)
+		}
+		if body != nil && op.RequestBody == nil {
+			t.Errorf("%s: sends a body, none is documented", request)
+		}
+		if body != nil && op.RequestBody != nil {
+			props := spec.properties(op.RequestBody.Content["application/json"].Schema)
+			for name := range body {
+				if !props[name] {
+					t.Errorf("%s: body field %s is not documented", request, name)
+				}
+			}
+		}
+		if _, ok := op.Responses["200"]; !ok {
+			if _, ok = op.Responses["201"]; !ok {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+
+	c := client.New(srv.URL)
+	v := reflect.ValueOf(c)
+	ctxType := reflect.TypeOf((*context.Context)(nil)).Elem()
+	for i := 0; i < v.NumMethod(); i++ {
+		m := v.Type().Method(i)
+		if m.Type.NumIn() < 2 || m.Type.In(1) != ctxType {
+			continue
+		}
+		before := len(called)
+		args := []reflect.Value{reflect.ValueOf(context.Background())}
+		for j := 2; j < m.Type.NumIn(); j++ {
+			args = append(args, filled(m.Type.In(j)))
+		}
+		for _, out := range v.Method(i).Call(args) {
+			if rc, ok := out.Interface().(io.ReadCloser); ok {
+				rc.Close()
+			}
+		}
+		if len(called) == before {
+			t.Errorf("Client.%s sent no request", m.Name)
+		}
+	}
+}
+
+// filled returns a value of typ with every field set, so that the client
+// sends every query parameter and body field it knows.
+func filled(typ reflect.Type) reflect.Value {
+	v := reflect.New(typ).Elem()
+	switch typ.Kind() {
+	case reflect.String:
+		v.SetString("1")
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Struct:
+		for i := 0; i < typ.NumField(); i++ {
+			if typ.Field(i).PkgPath == "" {
+				v.Field(i).Set(filled(typ.Field(i).Type))
+			}
+		}
+	case reflect.Func:
+		v = reflect.MakeFunc(typ, func([]reflect.Value) []reflect.Value {
+			out := make([]reflect.Value, typ.NumOut())
+			for i := range out {
+				out[i] = reflect.Zero(typ.Out(i))
+			}
+			return out
+		})
+	}
+	return v
+}
+
+// resolve follows the $ref of sc.
+func (s *openAPI) resolve(sc schema) schema {
+	for sc.Ref != "" {
+		sc = s.Components.Schemas[strings.TrimPrefix(sc.Ref, "#/components/schemas/")]
+	}
+	return sc
+}
+
+// response returns the documented JSON schema of the response of method on
+// path with status, ok is false when the status is not documented and body
+// when the response has no JSON body.
+func (s *openAPI) response(path, method string, status int) (sc schema, body, ok bool) {
+	op, _, found := s.operation(path, method)
+	if !found {
+		return schema{}, false, false
+	}
+	raw, found := op.Responses[strconv.Itoa(status)]
+	if !found {
+		return schema{}, false, false
+	}
+	var r response
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return schema{}, false, false
+	}
+	if r.Ref != "" {
+		r = s.Components.Responses[strings.TrimPrefix(r.Ref, "#/components/responses/")]
+	}
+	content, body := r.Content["application/json"]
+	return content.Schema, body, true
+}
+
+// check reports where value does not match sc: undocumented fields, missing
+// required fields and values of the wrong type.
+func (s *openAPI) check(t *testing.T, sc schema, value interface{}, where string) {
+	sc = s.resolve(sc)
+	if len(sc.AllOf) > 0 {
+		merged := schema{Type: "object", Properties: make(map[string]schema)}
+		for _, sub := range sc.AllOf {
+			sub = s.resolve(sub)
+			for name, p := range sub.Properties {
+				merged.Properties[name] = p
+			}
+			merged.Required = append(merged.Required, sub.Required...)
+		}
+		sc = merged
+	}
+	if sc.Type == "" && sc.Properties != nil {
+		sc.Type = "object"
+	}
+	switch sc.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			t.Errorf("%s: got %T, want an object", where, value)
+			return
+		}
+		for _, name := range sc.Required {
+			if _, ok := obj[name]; !ok {
+				t.Errorf("%s: required field %s is missing", where, name)
+			}
+		}
+		var values *schema
+		open := string(sc.AdditionalProperties) == "true"
+		if len(sc.AdditionalProperties) > 0 && !open {
+			values = new(schema)
+			if err := json.Unmarshal(sc.AdditionalProperties, values); err != nil {
+				t.Fatalf("%s: additionalProperties: %v", where, err)
+			}
+		}
+		for name, v := range obj {
+			p, ok := sc.Properties[name]
+			switch {
+			case ok:
+				s.check(t, p, v, where+"."+name)
+			case values != nil:
+				s.check(t, *values, v, where+"."+name)
+			case !open:
+				t.Errorf("%s: field %s is not documented", where, name)
+			}
+		}
+	case "array":
+		list, ok := value.([]interface{})
+		if !ok {
+			t.Errorf("%s: got %T, want an array", where, value)
+			return
+		}
+		for i, v := range list {
+			if sc.Items != nil {
+				s.check(t, *sc.Items, v, fmt.Sprintf("%s[%d]", where, i))
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			t.Errorf("%s: got %T, want a string", where, value)
+			return
+		}
+		if len(sc.Enum) > 0 {
+			for _, allowed := range sc.Enum {
+				if allowed == str {
+					return
+				}
+			}
+			t.Errorf("%s: %q is not one of %v", where, str, sc.Enum)
+		}
+	case "integer":
+		if n, ok := value.(json.Number); !ok {
+			t.Errorf("%s: got %T, want an integer", where, value)
+		} else if _, err := n.Int64(); err != nil {
+			t.Errorf("%s: %s is not an integer", where, n)
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			t.Errorf("%s: got %T, want a number", where, value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			t.Errorf("%s: got %T, want a boolean", where, value)
+		}
+	}
+}
+
+// TestResponsesDocumented calls the handlers through pkg/client against the
+// etcd server of the development setup and checks every response against
+// its documented schema. It is skipped when that server is not running.
+func TestResponsesDocumented(t *testing.T) {
+	const host = "127.0.0.1:2379"
+	conn, err := net.DialTimeout("tcp", host, time.Second)
+	if err != nil {
+		t.Skipf("no etcd server at %s: %v", host, err)
+	}
+	conn.Close()
+	tmp := t.TempDir()
+	args := []string{"-use-auth=false", "-allow-admin-without-auth", "-secret-key", "contract-test",
+		"-token-file", filepath.Join(tmp, "tokens.json"), "-audit-log-file", filepath.Join(tmp, "audit.log")}
+	if _, err := config.Load(config.NewFlagSet("test"), args); err != nil {
+		t.Fatal(err)
+	}
+	spec := loadSpec(t)
+	e := echo.New()
+	SetRoutes(e, fstest.MapFS{})
+
+	type exchange struct {
+		method, path string
+		status       int
+		body         []byte
+	}
+	var (
+		mu        sync.Mutex
+		exchanges []exchange
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, r)
+		mu.Lock()
+		exchanges = append(exchanges, exchange{r.Method, r.URL.Path, rec.Code, rec.Body.Bytes()})
+		mu.Unlock()
+		for name, values := range rec.Header() {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := client.New(srv.URL)
+	if _, err := c.Connect(ctx, types.ConnectRequest{Host: host}); err != nil {
+		t.Fatal(err)
+	}
+	dir := fmt.Sprintf("/contract-test/%d", time.Now().UnixNano())
+	kv, err := c.PutKey(ctx, types.PutKeyRequest{Key: dir + "/a", Value: `{"a": 1}`, TTL: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.DeleteKey(ctx, dir+"/", true)
+	var token *types.CreateTokenResponse
+
+	calls := []struct {
+		name  string
+		call  func() error
+		fails bool
+	}{
+		{"GetKey", func() error { _, err := c.GetKey(ctx, dir+"/a", ""); return err }, false},
+		{"GetKey missing", func() error { _, err := c.GetKey(ctx, dir+"/missing", ""); return err }, true},
+		{"GetKey unauthenticated", func() error { _, err := client.New(srv.URL).GetKey(ctx, dir+"/a", ""); return err }, true},
+		{"PutKey ttl and lease", func() error {
+			_, err := c.PutKey(ctx, types.PutKeyRequest{Key: dir + "/a", TTL: 60, Lease: kv.Lease})
+			return err
+		}, true},
+		{"ListKeys", func() error { _, err := c.ListKeys(ctx, types.ListKeysRequest{Prefix: dir + "/"}); return err }, false},
+		{"ListChildren", func() error { _, err := c.ListChildren(ctx, types.ChildrenRequest{Key: dir}); return err }, false},
+		{"Search", func() error { _, err := c.Search(ctx, types.SearchRequest{Key: dir, Pattern: "a"}); return err }, false},
+		{"Txn", func() error {
+			_, err := c.Txn(ctx, types.TxnRequest{Txn: types.Txn{
+				Compare: []types.Compare{{Key: dir + "/a", Target: "version", Result: ">", Version: 0}},
+				Success: []types.TxnOp{
+					{Type: "put", Key: dir + "/a", Value: `{"a": 2}`, PrevKV: true},
+					{Type: "range", Key: dir + "/", Prefix: true},
+				},
+			}})
+			return err
+		}, false},
+		{"Batch", func() error {
+			_, err := c.Batch(ctx, types.BatchRequest{Ops: []types.TxnOp{
+				{Type: "put", Key: dir + "/b", Value: "b"},
+				{Type: "delete", Key: dir + "/b"},
+			}})
+			return err
+		}, false},
+		{"Format", func() error {
+			_, err := c.Format(ctx, types.FormatRequest{Format: "json", Value: `{"b": 1, "a": 2}`, Sort: true})
+			return err
+		}, false},
+		{"Cluster", func() error { _, err := c.Cluster(ctx); return err }, false},
+		{"ListLeases", func() error { _, err := c.ListLeases(ctx, true); return err }, false},
+		{"GetLease", func() error { _, err := c.GetLease(ctx, kv.Lease); return err }, false},
+		{"KeepAliveLease", func() error { _, err := c.KeepAliveLease(ctx, kv.Lease); return err }, false},
+		{"ListAlarms", func() error { _, err := c.ListAlarms(ctx); return err }, false},
+		{"CreateToken", func() error {
+			token, err = c.CreateToken(ctx, types.CreateTokenRequest{Name: "contract-test"})
+			return err
+		}, false},
+		{"ListTokens", func() error { _, err := c.ListTokens(ctx); return err }, false},
+		{"RevokeToken", func() error { return c.RevokeToken(ctx, token.ID) }, false},
+		{"RevokeLease", func() error { return c.RevokeLease(ctx, kv.Lease) }, false},
+		{"DeleteKey", func() error { _, err := c.DeleteKey(ctx, dir+"/", true); return err }, false},
+	}
+	for _, call := range calls {
+		if err := call.call(); (err != nil) != call.fails {
+			t.Fatalf("%s: error %v, want failure %v", call.name, err, call.fails)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, x := range exchanges {
+		request := fmt.Sprintf("%s %s (%d)", x.method, x.path, x.status)
+		path, ok := spec.match(strings.TrimPrefix(x.path, apiPrefix))
+		if !ok {
+			t.Errorf("%s is not in openapi.json", request)
+			continue
+		}
+		sc, hasBody, ok := spec.response(path, x.method, x.status)
+		if !ok {
+			t.Errorf("%s: status is not documented", request)
+			continue
+		}
+		if !hasBody {
+			if len(x.body) > 0 {
+				t.Errorf("%s: body %s, none is documented", request, x.body)
+			}
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(x.body))
+		dec.UseNumber()
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			t.Errorf("%s: %v", request, err)
+			continue
+		}
+		spec.check(t, sc, value, request)
+	}
+}
@@ -6,24 +6,60 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/trinhdaiphuc/etcdkeeper/config"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/apiv1"
 	"github.com/trinhdaiphuc/etcdkeeper/pkg/controllers"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/health"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/logging"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/metrics"
 	"github.com/trinhdaiphuc/etcdkeeper/pkg/middlewares"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/tokens"
+	"io/fs"
+	"strings"
 )
 
-func SetRoutes(e *echo.Echo) {
+// SetRoutes registers the endpoints of the server, assets are the UI files
+// checked by the readiness probe.
+func SetRoutes(e *echo.Echo, assets fs.FS) {
+	session := func(c echo.Context) string {
+		if user, ok := middlewares.GetUserInfo(c); ok {
+			return user.Username + "@" + user.Host
+		}
+		return ""
+	}
+	e.Use(middleware.RequestID(), logging.Middleware(session), metrics.Middleware(session),
+		middlewares.ClientCert("/healthz", "/readyz"))
+	e.GET("/metrics", metrics.Handler())
+
+	// Probes stay outside of the groups using the JWT middleware.
+	e.GET("/healthz", health.Healthz)
+	e.GET("/readyz", health.Readyz(assets))
+	e.GET("/version", health.Version)
+
 	// Configure middleware with the custom claims type
 	config := middleware.JWTConfig{
 		Claims:     &middlewares.JwtCustomClaims{},
 		SigningKey: config.GetConfig().SecretKey,
 		Skipper: func(c echo.Context) bool {
 			if c.Path() == "/v2/separator" || c.Path() == "/v3/separator" ||
-				c.Path() == "/v2/connect" || c.Path() == "/v3/connect" {
+				c.Path() == "/v2/connect" || c.Path() == "/v3/connect" ||
+				c.Path() == "/api/v1/connect" {
 				return true
 			}
 			return false
 		},
 		ContextKey: middlewares.UserKey,
 		ParseTokenFunc: func(auth string, c echo.Context) (interface{}, error) {
+			if tokens.IsToken(auth) {
+				if !strings.HasPrefix(c.Path(), "/api/v1/") {
+					return nil, errors.New("API tokens are only accepted by /api/v1")
+				}
+				token, user, err := tokens.Default().Authenticate(auth)
+				if err != nil {
+					return nil, err
+				}
+				c.Set(middlewares.TokenKey, token)
+				return user, nil
+			}
 			token, err := jwt.ParseWithClaims(auth, &middlewares.JwtCustomClaims{}, func(tkn *jwt.Token) (interface{}, error) {
 				return config.GetConfig().SecretKey, nil
 			})
@@ -51,6 +87,8 @@ func SetRoutes(e *echo.Echo) {
 	v2.PUT("/put", controllers.PutV2)
 	v2.POST("/delete", controllers.DelV2)
 	v2.GET("/getpath", controllers.GetPathV2)
+	v2.GET("/pool", controllers.GetPoolV2)
+	v2.POST("/format", controllers.Format)
 
 	v3 := e.Group("/v3")
 	v3.Use(middleware.JWTWithConfig(config))
@@ -59,5 +97,36 @@ func SetRoutes(e *echo.Echo) {
 	v3.GET("/get", controllers.GetV3)
 	v3.PUT("/put", controllers.PutV3)
 	v3.POST("/delete", controllers.DelV3)
+	v3.POST("/txn", controllers.TxnV3)
+	v3.POST("/batch", controllers.BatchV3)
 	v3.GET("/getpath", controllers.GetPathV3)
+	v3.GET("/search", controllers.SearchV3)
+	v3.POST("/format", controllers.Format)
+	v3.GET("/pool", controllers.GetPoolV3)
+	v3.GET("/cluster", controllers.GetClusterV3)
+	v3.GET("/leases", controllers.GetLeasesV3)
+	v3.GET("/lease", controllers.GetLeaseV3)
+	v3.POST("/lease/revoke", controllers.RevokeLeaseV3)
+	v3.POST("/lease/keepalive", controllers.KeepAliveLeaseV3)
+
+	admin := v3.Group("/admin", middlewares.AdminOnly)
+	admin.POST("/member/add", controllers.AddMemberV3)
+	admin.POST("/member/remove", controllers.RemoveMemberV3)
+	admin.POST("/member/update", controllers.UpdateMemberV3)
+	admin.POST("/member/promote", controllers.PromoteMemberV3)
+	admin.POST("/compact", controllers.CompactV3)
+	admin.POST("/defragment", controllers.DefragmentV3)
+	admin.GET("/alarms", controllers.GetAlarmsV3)
+	admin.POST("/alarm/disarm", controllers.DisarmAlarmV3)
+	admin.GET("/snapshot", controllers.SnapshotV3)
+	admin.GET("/protos", controllers.GetProtosV3)
+	admin.POST("/protos/descriptors", controllers.UploadDescriptorSetV3)
+	admin.POST("/protos/descriptors/remove", controllers.RemoveDescriptorSetV3)
+	admin.POST("/protos/mapping", controllers.SetProtoMappingV3)
+	admin.POST("/protos/mapping/remove", controllers.RemoveProtoMappingV3)
+
+	e.GET("/openapi.json", apiv1.OpenAPI)
+	api := e.Group("/api/v1")
+	api.Use(apiv1.Errors, middleware.JWTWithConfig(config))
+	apiv1.SetRoutes(api)
 }
@@ -0,0 +1,92 @@
+package schemas
+
+import (
+	"context"
+	"sync"
+
+	"github.com/trinhdaiphuc/etcdkeeper/config"
+)
+
+// cacheKey identifies the schemas stored in a keyspace of a cluster.
+type cacheKey struct {
+	version string
+	host    string
+	prefix  string
+}
+
+type cacheEntry struct {
+	list []*Schema
+	stop context.CancelFunc
+}
+
+// storedCache keeps the compiled schemas stored in each cluster so that
+// writes do not read and compile them again. An entry lives as long as a
+// watch on the schema prefix: the first change, or the end of the watch when
+// its client is closed, drops it and the next write reads the schemas again.
+// Watches end after POOL_IDLE_TTL at the latest, handing back the client of
+// SCHEMA_USER so that a reset of the pools reaches it too.
+type storedCache struct {
+	mu      sync.Mutex
+	entries map[cacheKey]*cacheEntry
+}
+
+var cache = &storedCache{entries: make(map[cacheKey]*cacheEntry)}
+
+func init() {
+	config.OnReload(func(old, new *config.AppConfig) {
+		if old.SchemaPrefix != new.SchemaPrefix || old.SchemaUser != new.SchemaUser || old.SchemaPassword != new.SchemaPassword {
+			cache.clear()
+		}
+	})
+}
+
+func (c *storedCache) get(key cacheKey) ([]*Schema, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	return e.list, true
+}
+
+// keep caches list, read at a revision watch starts after, and returns the
+// list to use. watch returns once the schemas may have changed or its
+// context is done, release is called after it to hand back the client the
+// schemas were read with. When another request cached the schemas first,
+// that entry is kept and returned instead and release is called at once.
+func (c *storedCache) keep(key cacheKey, list []*Schema, release func(), watch func(ctx context.Context)) []*Schema {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		release()
+		return e.list
+	}
+	ctx, stop := context.WithTimeout(context.Background(), config.GetConfig().PoolIdleTTL)
+	e := &cacheEntry{list: list, stop: stop}
+	c.entries[key] = e
+	go func() {
+		watch(ctx)
+		release()
+		c.forget(key, e)
+	}()
+	return list
+}
+
+func (c *storedCache) forget(key cacheKey, e *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries[key] == e {
+		delete(c.entries, key)
+	}
+	e.stop()
+}
+
+func (c *storedCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, e := range c.entries {
+		delete(c.entries, key)
+		e.stop()
+	}
+}
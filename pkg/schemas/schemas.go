@@ -0,0 +1,290 @@
+// Package schemas validates values against JSON Schema documents registered
+// for key patterns. Schemas come from the file set by SCHEMA_FILE and from
+// the keys under SCHEMA_PREFIX in the cluster being written to, where every
+// key holds a document of the form {"pattern": "/config/**", "schema": {}}.
+package schemas
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/trinhdaiphuc/etcdkeeper/config"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/apiv1/types"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/etcd"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/formats"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/keymatch"
+	"github.com/xeipuuv/gojsonschema"
+	"go.etcd.io/etcd/client/v2"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+)
+
+// Schema is a JSON Schema applied to the keys matching Pattern.
+type Schema struct {
+	Name    string          `json:"name"`
+	Pattern string          `json:"pattern"`
+	Schema  json.RawMessage `json:"schema"`
+
+	match  *keymatch.Pattern
+	schema *gojsonschema.Schema
+}
+
+// FieldError is a single violation, Path is a JSON pointer into the value.
+type FieldError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned for a value that does not match its schema.
+type ValidationError struct {
+	Key    string       `json:"key"`
+	Schema string       `json:"schema"`
+	Errors []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, f := range e.Errors {
+		path := f.Path
+		if path == "" {
+			path = "(root)"
+		}
+		msgs = append(msgs, path+": "+f.Message)
+	}
+	return fmt.Sprintf("value of %s does not match schema %s: %s", e.Key, e.Schema, strings.Join(msgs, "; "))
+}
+
+func (s *Schema) compile(separator string) error {
+	if s.Pattern == "" || len(s.Schema) == 0 {
+		return fmt.Errorf("schema %s: pattern and schema are required", s.Name)
+	}
+	var err error
+	if s.match, err = keymatch.Compile(s.Pattern, separator); err != nil {
+		return fmt.Errorf("schema %s: %v", s.Name, err)
+	}
+	if s.schema, err = gojsonschema.NewSchema(gojsonschema.NewBytesLoader(s.Schema)); err != nil {
+		return fmt.Errorf("schema %s: %v", s.Name, err)
+	}
+	return nil
+}
+
+// Parse parses a schema document stored under the schema prefix.
+func Parse(name string, data []byte) (*Schema, error) {
+	s := &Schema{Name: name}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("schema %s: %v", name, err)
+	}
+	s.Name = name
+	if err := s.compile(config.GetConfig().Separator); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+var (
+	once        sync.Once
+	fileSchemas []*Schema
+)
+
+// fromFile returns the schemas of SCHEMA_FILE, a JSON list of schemas with a
+// name, a pattern and a schema. The file is read once, a file that cannot be
+// loaded is logged and ignored.
+func fromFile() []*Schema {
+	once.Do(func() {
+		cfg := config.GetConfig()
+		if cfg.SchemaFile == "" {
+			return
+		}
+		data, err := ioutil.ReadFile(cfg.SchemaFile)
+		if err != nil {
+			zap.L().Error("schemas: load", zap.Error(err))
+			return
+		}
+		var list []*Schema
+		if err = json.Unmarshal(data, &list); err != nil {
+			zap.L().Error("schemas: load", zap.String("file", cfg.SchemaFile), zap.Error(err))
+			return
+		}
+		for _, s := range list {
+			if err = s.compile(cfg.Separator); err != nil {
+				zap.L().Error("schemas: compile", zap.String("file", cfg.SchemaFile), zap.Error(err))
+				continue
+			}
+			fileSchemas = append(fileSchemas, s)
+		}
+	})
+	return fileSchemas
+}
+
+// IsSchemaKey reports whether key is a schema document under the prefix.
+func IsSchemaKey(key string) bool {
+	prefix := config.GetConfig().SchemaPrefix
+	return prefix != "" && strings.HasPrefix(key, prefix) && key != prefix
+}
+
+// schemaUser is the etcd user reading the schemas stored on host. It is the
+// same for every request, so the schemas applied to a write do not depend on
+// the permissions of its user.
+func schemaUser(host string) etcd.UserInfo {
+	cfg := config.GetConfig()
+	return etcd.UserInfo{Host: host, Username: cfg.SchemaUser, Password: cfg.SchemaPassword}
+}
+
+// ForV3 returns the file schemas followed by the ones stored in the cluster
+// at host, read as SCHEMA_USER. Documents that do not parse are logged and
+// skipped so one bad schema does not block every write. Stored schemas are
+// cached until they change, see cache.go.
+func ForV3(ctx context.Context, host string) ([]*Schema, error) {
+	prefix := config.GetConfig().SchemaPrefix
+	if prefix == "" {
+		return fromFile(), nil
+	}
+	key := cacheKey{version: "v3", host: host, prefix: prefix}
+	if stored, ok := cache.get(key); ok {
+		return withFile(stored), nil
+	}
+	cli, err := etcd.GetClientV3(schemaUser(host))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cli.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		cli.Release()
+		return nil, err
+	}
+	var stored []*Schema
+	for _, kv := range resp.Kvs {
+		stored = appendStored(stored, string(kv.Key), kv.Value)
+	}
+	stored = cache.keep(key, stored, cli.Release, func(ctx context.Context) {
+		ctx = clientv3.WithRequireLeader(ctx)
+		// Any event, or the end of the watch, means the schemas may have
+		// changed since they were read.
+		<-cli.Watch(ctx, prefix, clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1))
+	})
+	return withFile(stored), nil
+}
+
+// ForV2 is ForV3 for the v2 keyspace.
+func ForV2(ctx context.Context, host string) ([]*Schema, error) {
+	prefix := config.GetConfig().SchemaPrefix
+	if prefix == "" {
+		return fromFile(), nil
+	}
+	key := cacheKey{version: "v2", host: host, prefix: prefix}
+	if stored, ok := cache.get(key); ok {
+		return withFile(stored), nil
+	}
+	cli, err := etcd.GetClientV2(schemaUser(host))
+	if err != nil {
+		return nil, err
+	}
+	keys := etcd.NewKeysAPI(cli)
+	var (
+		stored []*Schema
+		index  uint64
+	)
+	resp, err := keys.Get(ctx, prefix, &client.GetOptions{Recursive: true})
+	if cerr, ok := err.(client.Error); ok && cerr.Code == client.ErrorCodeKeyNotFound {
+		index = cerr.Index
+	} else if err != nil {
+		cli.Release()
+		return nil, err
+	} else {
+		index = resp.Index
+		var walk func(n *client.Node)
+		walk = func(n *client.Node) {
+			if !n.Dir {
+				stored = appendStored(stored, n.Key, []byte(n.Value))
+			}
+			for _, c := range n.Nodes {
+				walk(c)
+			}
+		}
+		walk(resp.Node)
+	}
+	stored = cache.keep(key, stored, cli.Release, func(ctx context.Context) {
+		w := keys.Watcher(prefix, &client.WatcherOptions{AfterIndex: index, Recursive: true})
+		w.Next(ctx)
+	})
+	return withFile(stored), nil
+}
+
+// withFile returns the file schemas followed by stored in a new slice, the
+// cached lists are shared by every request.
+func withFile(stored []*Schema) []*Schema {
+	file := fromFile()
+	list := make([]*Schema, 0, len(file)+len(stored))
+	return append(append(list, file...), stored...)
+}
+
+func appendStored(list []*Schema, key string, value []byte) []*Schema {
+	s, err := Parse(strings.TrimPrefix(key, config.GetConfig().SchemaPrefix), value)
+	if err != nil {
+		zap.L().Error("schemas: parse stored schema", zap.String("key", key), zap.Error(err))
+		return list
+	}
+	return append(list, s)
+}
+
+// Validate checks value against every schema whose pattern matches key.
+// Schema documents written under the schema prefix are checked to be valid
+// schemas themselves.
+func Validate(list []*Schema, key string, value []byte) error {
+	if IsSchemaKey(key) {
+		_, err := Parse(strings.TrimPrefix(key, config.GetConfig().SchemaPrefix), value)
+		return err
+	}
+	for _, s := range list {
+		if !s.match.Match(key) {
+			continue
+		}
+		if !json.Valid(value) {
+			return &ValidationError{Key: key, Schema: s.Name, Errors: []FieldError{{Path: "", Message: "value is not valid JSON"}}}
+		}
+		result, err := s.schema.Validate(gojsonschema.NewBytesLoader(value))
+		if err != nil {
+			return fmt.Errorf("schema %s: %v", s.Name, err)
+		}
+		if result.Valid() {
+			continue
+		}
+		verr := &ValidationError{Key: key, Schema: s.Name}
+		for _, e := range result.Errors() {
+			verr.Errors = append(verr.Errors, FieldError{Path: pointer(e.Context()), Message: e.Description()})
+		}
+		return verr
+	}
+	return nil
+}
+
+// ValidateOps checks the values of the puts among ops: they must decode in
+// encoding, match their schemas and, when validateFormat is set, parse in
+// the format of their key. It returns the error of every op, nil for the
+// ones that passed and for those that are not puts.
+func ValidateOps(list []*Schema, ops []etcd.TxnOp, encoding string, validateFormat bool) []error {
+	errs := make([]error, len(ops))
+	for i, op := range ops {
+		if op.Type != "put" {
+			continue
+		}
+		value, err := types.DecodeValue(op.Value, encoding)
+		if err == nil {
+			err = Validate(list, op.Key, value)
+		}
+		if format := formats.ForKey(op.Key); err == nil && validateFormat && format != "" {
+			err = formats.Validate(format, value)
+		}
+		errs[i] = err
+	}
+	return errs
+}
+
+// pointer turns the context of an error, "(root).a.0", into "/a/0".
+func pointer(ctx *gojsonschema.JsonContext) string {
+	return strings.TrimPrefix(ctx.String("/"), "(root)")
+}
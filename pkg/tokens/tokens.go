@@ -0,0 +1,332 @@
+// Package tokens manages long-lived API tokens for automation. A token is
+// bound to an etcd cluster and user and restricted to a key prefix, read-only
+// or read-write. Only a hash of the token is stored, along with the etcd
+// password encrypted with SECRET_KEY, in the file set by TOKEN_FILE.
+package tokens
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/trinhdaiphuc/etcdkeeper/config"
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/etcd"
+	"go.uber.org/zap"
+)
+
+// Prefix starts every API token, telling them apart from the JWTs of
+// interactive logins.
+const Prefix = "ekt_"
+
+const (
+	Read      = "read"
+	ReadWrite = "readwrite"
+)
+
+// ErrInvalidToken is returned for unknown, revoked and expired tokens.
+var ErrInvalidToken = errors.New("invalid or expired API token")
+
+// Token describes an API token. The token itself is only returned once, by
+// Create.
+type Token struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Host      string    `json:"host"`
+	Username  string    `json:"username,omitempty"`
+	Prefix    string    `json:"prefix"`
+	Access    string    `json:"access"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	// ExpiresAt is nil for tokens that do not expire.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// Allows reports whether the token may access key, or every key starting
+// with it. Writes need read-write access.
+func (t *Token) Allows(key string, write bool) bool {
+	if write && t.Access != ReadWrite {
+		return false
+	}
+	return strings.HasPrefix(key, t.Prefix)
+}
+
+func (t *Token) expired(now time.Time) bool {
+	return t.ExpiresAt != nil && now.After(*t.ExpiresAt)
+}
+
+// stored is a token as saved in the file.
+type stored struct {
+	Token
+	Hash     string `json:"hash"`
+	Password string `json:"password,omitempty"`
+}
+
+// Options are the settings of a new token.
+type Options struct {
+	Name string
+	// User is the etcd cluster and credentials requests are made with.
+	User      etcd.UserInfo
+	Prefix    string
+	Access    string
+	CreatedBy string
+	// TTL is how long the token is valid, forever when zero.
+	TTL time.Duration
+}
+
+// Store holds the API tokens of a file.
+type Store struct {
+	path string
+	key  []byte
+
+	mu     sync.RWMutex
+	tokens []*stored
+}
+
+var (
+	once  sync.Once
+	store *Store
+)
+
+// Default returns the store of the configured file, loading it on first use.
+// A file that cannot be read leaves the store empty.
+func Default() *Store {
+	once.Do(func() {
+		cfg := config.GetConfig()
+		var err error
+		if store, err = Open(cfg.TokenFile, cfg.SecretKey); err != nil {
+			zap.L().Error("tokens: load", zap.String("file", cfg.TokenFile), zap.Error(err))
+			store = &Store{path: cfg.TokenFile, key: encryptionKey(cfg.SecretKey)}
+		}
+	})
+	return store
+}
+
+// Open loads the tokens saved in path, secret encrypts the etcd passwords.
+// A missing file is an empty store.
+func Open(path string, secret []byte) (*Store, error) {
+	s := &Store{path: path, key: encryptionKey(secret)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &s.tokens); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// IsToken reports whether auth looks like an API token rather than a JWT.
+func IsToken(auth string) bool {
+	return strings.HasPrefix(auth, Prefix)
+}
+
+// List returns the tokens sorted by name.
+func (s *Store) List() []Token {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]Token, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		list = append(list, t.Token)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Create adds a token and returns it, along with its description.
+func (s *Store) Create(opts Options) (string, Token, error) {
+	if opts.Name == "" {
+		return "", Token{}, errors.New("name is required")
+	}
+	if opts.User.Host == "" {
+		return "", Token{}, errors.New("host is required")
+	}
+	switch opts.Access {
+	case "":
+		opts.Access = Read
+	case Read, ReadWrite:
+	default:
+		return "", Token{}, fmt.Errorf("invalid access %q, expected %s or %s", opts.Access, Read, ReadWrite)
+	}
+	if opts.TTL < 0 {
+		return "", Token{}, errors.New("ttl must not be negative")
+	}
+
+	id, err := randomBytes(8)
+	if err != nil {
+		return "", Token{}, err
+	}
+	secret, err := randomBytes(32)
+	if err != nil {
+		return "", Token{}, err
+	}
+	raw := Prefix + hex.EncodeToString(id) + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	t := &stored{
+		Token: Token{
+			ID:        hex.EncodeToString(id),
+			Name:      opts.Name,
+			Host:      opts.User.Host,
+			Username:  opts.User.Username,
+			Prefix:    opts.Prefix,
+			Access:    opts.Access,
+			CreatedBy: opts.CreatedBy,
+			CreatedAt: time.Now().UTC(),
+		},
+		Hash: hash(raw),
+	}
+	if opts.TTL > 0 {
+		expiresAt := t.CreatedAt.Add(opts.TTL)
+		t.ExpiresAt = &expiresAt
+	}
+	if opts.User.Password != "" {
+		if t.Password, err = s.encrypt(opts.User.Password); err != nil {
+			return "", Token{}, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, other := range s.tokens {
+		if other.Name == opts.Name {
+			return "", Token{}, fmt.Errorf("token %s already exists", opts.Name)
+		}
+	}
+	if err = s.save(append(s.tokens, t)); err != nil {
+		return "", Token{}, err
+	}
+	return raw, t.Token, nil
+}
+
+// Revoke deletes the token with the given ID.
+func (s *Store) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, t := range s.tokens {
+		if t.ID == id {
+			tokens := append(append([]*stored(nil), s.tokens[:i]...), s.tokens[i+1:]...)
+			return s.save(tokens)
+		}
+	}
+	return fmt.Errorf("token %s not found", id)
+}
+
+// Authenticate returns the token raw stands for and the etcd user to make
+// requests with.
+func (s *Store) Authenticate(raw string) (*Token, *etcd.UserInfo, error) {
+	parts := strings.SplitN(strings.TrimPrefix(raw, Prefix), "_", 2)
+	if !IsToken(raw) || len(parts) != 2 {
+		return nil, nil, ErrInvalidToken
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, t := range s.tokens {
+		if t.ID != parts[0] {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hash(raw))) != 1 || t.expired(time.Now()) {
+			return nil, nil, ErrInvalidToken
+		}
+		user := &etcd.UserInfo{Host: t.Host, Username: t.Username}
+		if t.Password != "" {
+			password, err := s.decrypt(t.Password)
+			if err != nil {
+				return nil, nil, fmt.Errorf("token %s: %v", t.Name, err)
+			}
+			user.Password = password
+		}
+		token := t.Token
+		return &token, user, nil
+	}
+	return nil, nil, ErrInvalidToken
+}
+
+func (s *Store) save(tokens []*stored) error {
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(s.path); dir != "" {
+		if err = os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+	}
+	if err = ioutil.WriteFile(s.path, data, 0600); err != nil {
+		return err
+	}
+	s.tokens = tokens
+	return nil
+}
+
+func (s *Store) encrypt(plaintext string) (string, error) {
+	gcm, err := s.cipher()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomBytes(gcm.NonceSize())
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(plaintext), nil)), nil
+}
+
+func (s *Store) decrypt(ciphertext string) (string, error) {
+	gcm, err := s.cipher()
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return "", errors.New("malformed password")
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("cannot decrypt the password, was SECRET_KEY changed?")
+	}
+	return string(plaintext), nil
+}
+
+func (s *Store) cipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(s.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptionKey derives an AES-256 key from SECRET_KEY.
+func encryptionKey(secret []byte) []byte {
+	sum := sha256.Sum256(append([]byte("etcdkeeper tokens\x00"), secret...))
+	return sum[:]
+}
+
+// hash hashes a token for storage. Tokens are random, a plain SHA-256 is
+// enough to keep them from being recovered from the file.
+func hash(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
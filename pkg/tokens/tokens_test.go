@@ -0,0 +1,144 @@
+package tokens
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trinhdaiphuc/etcdkeeper/pkg/etcd"
+)
+
+func openStore(t *testing.T, secret string) (*Store, string) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	s, err := Open(path, []byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, path
+}
+
+func TestAuthenticate(t *testing.T) {
+	s, path := openStore(t, "secret")
+	raw, token, err := s.Create(Options{
+		Name:   "deploy",
+		User:   etcd.UserInfo{Host: "http://127.0.0.1:2379", Username: "root", Password: "hunter2"},
+		Prefix: "/app/",
+		Access: ReadWrite,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsToken(raw) {
+		t.Errorf("token %q does not start with %s", raw, Prefix)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{raw, "hunter2"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("%s holds %q in clear", path, secret)
+		}
+	}
+
+	// A store reading the same file with the same secret knows the token.
+	reopened, err := Open(path, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, user, err := reopened.Authenticate(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != token.ID || got.Prefix != "/app/" || got.Access != ReadWrite {
+		t.Errorf("Authenticate = %+v, want %+v", got, token)
+	}
+	want := etcd.UserInfo{Host: "http://127.0.0.1:2379", Username: "root", Password: "hunter2"}
+	if *user != want {
+		t.Errorf("user = %+v, want %+v", *user, want)
+	}
+
+	for _, bad := range []string{raw[:len(raw)-1] + "x", Prefix + token.ID, "ekt_unknown_x", strings.TrimPrefix(raw, Prefix)} {
+		if _, _, err := reopened.Authenticate(bad); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Authenticate(%q) = %v, want %v", bad, err, ErrInvalidToken)
+		}
+	}
+
+	// The password cannot be decrypted once SECRET_KEY changed.
+	other, err := Open(path, []byte("other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := other.Authenticate(raw); err == nil || errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Authenticate with another secret = %v, want a decryption error", err)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	s, _ := openStore(t, "secret")
+	raw, token, err := s.Create(Options{Name: "ci", User: etcd.UserInfo{Host: "h"}, TTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.ExpiresAt == nil || token.ExpiresAt.Sub(token.CreatedAt) != time.Hour {
+		t.Fatalf("ExpiresAt = %v, want an hour after %v", token.ExpiresAt, token.CreatedAt)
+	}
+	if _, _, err = s.Authenticate(raw); err != nil {
+		t.Fatalf("Authenticate before expiry: %v", err)
+	}
+
+	past := time.Now().Add(-time.Second)
+	s.tokens[0].ExpiresAt = &past
+	if _, _, err = s.Authenticate(raw); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Authenticate after expiry = %v, want %v", err, ErrInvalidToken)
+	}
+
+	if _, _, err = s.Create(Options{Name: "negative", User: etcd.UserInfo{Host: "h"}, TTL: -time.Hour}); err == nil {
+		t.Error("Create accepted a negative TTL")
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	s, _ := openStore(t, "secret")
+	raw, token, err := s.Create(Options{Name: "ci", User: etcd.UserInfo{Host: "h"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.ExpiresAt != nil || token.Access != Read {
+		t.Errorf("token = %+v, want read access without expiry", token)
+	}
+	if err = s.Revoke(token.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = s.Authenticate(raw); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Authenticate after Revoke = %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func TestAllows(t *testing.T) {
+	read := Token{Prefix: "/app/", Access: Read}
+	write := Token{Prefix: "/app/", Access: ReadWrite}
+	tests := []struct {
+		token Token
+		key   string
+		write bool
+		want  bool
+	}{
+		{read, "/app/a", false, true},
+		{read, "/app/a", true, false},
+		{read, "/other", false, false},
+		{read, "", false, false},
+		{write, "/app/a", true, true},
+		{write, "/other", true, false},
+		{Token{Access: Read}, "", false, true},
+	}
+	for _, tt := range tests {
+		if got := tt.token.Allows(tt.key, tt.write); got != tt.want {
+			t.Errorf("%+v.Allows(%q, %v) = %v, want %v", tt.token, tt.key, tt.write, got, tt.want)
+		}
+	}
+}
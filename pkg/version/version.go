@@ -0,0 +1,57 @@
+// Package version describes the build of the binary. Release builds set the
+// variables with the linker:
+//
+//	go build -ldflags "-X github.com/trinhdaiphuc/etcdkeeper/pkg/version.Version=v1.2.0 \
+//		-X github.com/trinhdaiphuc/etcdkeeper/pkg/version.Commit=$(git rev-parse --short HEAD) \
+//		-X github.com/trinhdaiphuc/etcdkeeper/pkg/version.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	etcdversion "go.etcd.io/etcd/api/v3/version"
+)
+
+var (
+	// Version is the release, the module version for go install builds and
+	// dev otherwise.
+	Version = ""
+	Commit  = ""
+	// Date is when the binary was built.
+	Date = ""
+)
+
+// Info is the build information of the binary.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"date,omitempty"`
+	GoVersion string `json:"goVersion"`
+	// EtcdClient is the version of the etcd client library.
+	EtcdClient string `json:"etcdClient"`
+}
+
+// Get returns the build information.
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, Date: Date, GoVersion: runtime.Version(), EtcdClient: etcdversion.Version}
+	if info.Version == "" {
+		info.Version = "dev"
+		if bi, ok := debug.ReadBuildInfo(); ok && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+	}
+	return info
+}
+
+func (i Info) String() string {
+	s := i.Version
+	if i.Commit != "" {
+		s += " (" + i.Commit + ")"
+	}
+	if i.Date != "" {
+		s += " built " + i.Date
+	}
+	return fmt.Sprintf("%s, %s, etcd client %s", s, i.GoVersion, i.EtcdClient)
+}